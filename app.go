@@ -55,7 +55,7 @@ func (a *App) SaveFile(idx int) error {
     }
     dbcFile := a.dbcFiles[idx]
 
-    if err := dbcFile.Save(dbcFile.FileName); err != nil {
+    if err := dbcFile.SaveWithOptions(dbcFile.FileName, dbc.SaveOptions{PreserveFormatting: true}); err != nil {
         return fmt.Errorf("could not save DBC: %w", err)
     }
 
@@ -84,14 +84,21 @@ func (a *App) SaveFileAs(idx int) error {
         return nil
     }
     
-    if err := dbcFile.Save(path); err != nil {
+    if err := dbcFile.SaveWithOptions(path, dbc.SaveOptions{PreserveFormatting: true}); err != nil {
         return fmt.Errorf("could not save DBC: %w", err)
     }
 
     return nil
 }
 
-func (a *App) ParseDBC() error {
+// GetEncodings lists the encodings ParseDBC accepts besides "" (detect)
+func (a *App) GetEncodings() []dbc.Encoding {
+    return dbc.Encodings
+}
+
+// ParseDBC asks for a file and loads it. encoding is one of GetEncodings,
+// or "" to detect it.
+func (a *App) ParseDBC(encoding string) error {
 		selection, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
         Title: "Select File",
         Filters: []runtime.FileFilter{
@@ -113,13 +120,15 @@ func (a *App) ParseDBC() error {
     defer file.Close()
 
     // Parse it
-    parser := dbc.NewParser()
+    parser := dbc.NewParserWithOptions(dbc.ParseOptions{Lenient: true, FileName: selection, KeepSource: true, Encoding: dbc.Encoding(encoding)})
     dbcFile, err := parser.Parse(file)
     if err != nil {
         return fmt.Errorf("parse error: %w", err)
     }
 
 		dbcFile.FileName = selection
+    // list model problems with the statements the parser skipped
+    dbcFile.Diagnostics = append(dbcFile.Diagnostics, dbcFile.ValidationDiagnostics()...)
 
 		a.dbcFiles = append(a.dbcFiles, *dbcFile)
 
@@ -131,3 +140,30 @@ func (a *App) ParseDBC() error {
 func (a *App) GetDBCFiles() []dbc.DBCFile {
 	  return a.dbcFiles
 }
+
+// GetEffectiveAttribute returns the value of attrName for an object of the
+// file at idx, falling back to the BA_DEF_DEF_ default when not overridden
+func (a *App) GetEffectiveAttribute(idx int, objectType, objectName, attrName string) (string, error) {
+    if idx < 0 || idx >= len(a.dbcFiles) {
+        return "", fmt.Errorf("GetEffectiveAttribute: index %d out of range", idx)
+    }
+    return a.dbcFiles[idx].EffectiveAttribute(objectType, objectName, attrName)
+}
+
+// SetSignalValueDescriptions replaces the VAL_ entries of one signal in the
+// file at idx. msgID is the raw BO_ ID (bit 31 set for extended frames).
+func (a *App) SetSignalValueDescriptions(idx int, msgID uint32, signal string, values map[int]string) error {
+    if idx < 0 || idx >= len(a.dbcFiles) {
+        return fmt.Errorf("SetSignalValueDescriptions: index %d out of range", idx)
+    }
+    msg := a.dbcFiles[idx].MessageByID(msgID)
+    if msg == nil {
+        return fmt.Errorf("SetSignalValueDescriptions: no message with ID %d", msgID)
+    }
+    sig := msg.SignalByName(signal)
+    if sig == nil {
+        return fmt.Errorf("SetSignalValueDescriptions: no signal %q in message %s", signal, msg.Name)
+    }
+    sig.ValueDescriptions = values
+    return nil
+}
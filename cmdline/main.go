@@ -12,7 +12,15 @@ import (
 func main() {
     // Define and parse command‐line flags
     var path string
+    var showAttrs bool
+    var lenient bool
+    var strict bool
+    var encoding string
     flag.StringVar(&path, "f", "", "Path to the .dbc file to parse")
+    flag.BoolVar(&showAttrs, "attrs", false, "Print effective attribute values (BA_ or BA_DEF_DEF_ default)")
+    flag.BoolVar(&lenient, "lenient", false, "Skip malformed statements and list them instead of failing")
+    flag.BoolVar(&strict, "strict", false, "Report every deviation from the DBC grammar and exit with status 1 if there are any problems")
+    flag.StringVar(&encoding, "encoding", "", "Input encoding (utf-8, utf-8-bom, utf-16le, utf-16be, windows-1252, iso-8859-1, shift_jis); detected if empty")
     flag.Parse()
 
     if path == "" {
@@ -28,15 +36,25 @@ func main() {
     defer file.Close()
 
     // Parse it
-    parser := dbc.NewParser()
+    parser := dbc.NewParserWithOptions(dbc.ParseOptions{
+        Lenient:  lenient,
+        Strict:   strict,
+        FileName: path,
+        Encoding: dbc.Encoding(encoding),
+    })
     dbcFile, err := parser.Parse(file)
     if err != nil {
         log.Fatalf("Parse error: %v", err)
     }
+    problems := append(dbcFile.Diagnostics, dbcFile.ValidationDiagnostics()...)
+    for _, d := range problems {
+        fmt.Fprintf(os.Stderr, "%s:%s\n", path, d)
+    }
 
     // Output a brief summary
 		fmt.Printf("Parsed DBC: %s\n", path)
 		fmt.Printf("  version=%q, author=%q\n", dbcFile.Version, dbcFile.Author)
+    fmt.Printf("  Encoding:     %s\n", dbcFile.Encoding)
     fmt.Printf("  Nodes:        %d\n", len(dbcFile.Nodes))
     fmt.Printf("  BaudRates:    %d\n", len(dbcFile.BaudRates))
     fmt.Printf("  Messages:     %d\n", len(dbcFile.Messages))
@@ -46,10 +64,58 @@ func main() {
         totalSignals += len(msg.Signals)
     }
     fmt.Printf("    └─ Signals: %d\n", totalSignals)
+    fmt.Printf("  EnvVars:      %d\n", len(dbcFile.EnvVars))
 
     fmt.Printf("  ValueTables:  %d\n", len(dbcFile.ValueTables))
     fmt.Printf("  Attributes:   %d defs, %d values\n",
         len(dbcFile.Attributes), len(dbcFile.AttrValues))
     fmt.Printf("  Comments:     %d\n", len(dbcFile.Comments))
+
+    if showAttrs {
+        printAttributes(dbcFile)
+    }
+    if strict && len(problems) > 0 {
+        os.Exit(1)
+    }
 }
 
+// printAttributes lists the effective value of every attribute definition
+// for each object it applies to
+func printAttributes(f *dbc.DBCFile) {
+    fmt.Println("Attributes:")
+    for _, def := range f.Attributes {
+        scopes := def.AppliesTo
+        if len(scopes) == 0 {
+            scopes = []string{""}
+        }
+        for _, scope := range scopes {
+            printAttribute(f, def, scope)
+        }
+    }
+}
+
+// printAttribute lists the effective value of def for each object of one type
+func printAttribute(f *dbc.DBCFile, def dbc.AttributeDefinition, scope string) {
+    switch scope {
+    case "":
+        v, _ := f.NetworkAttribute(def.Name)
+        fmt.Printf("  %s = %q\n", def.Name, v)
+    case "BU_":
+        for _, n := range f.Nodes {
+            v, _ := f.NodeAttribute(n.Name, def.Name)
+            fmt.Printf("  BU_ %s %s = %q\n", n.Name, def.Name, v)
+        }
+    case "BO_":
+        for _, msg := range f.Messages {
+            v, _ := f.MessageAttribute(msg.RawID(), def.Name)
+            fmt.Printf("  BO_ %s %s = %q\n", msg.Name, def.Name, v)
+        }
+    case "SG_":
+        for _, msg := range f.Messages {
+            for _, sig := range msg.Signals {
+                v, _ := f.SignalAttribute(msg.RawID(), sig.Name, def.Name)
+                fmt.Printf("  SG_ %s.%s %s = %q\n", msg.Name, sig.Name, def.Name, v)
+            }
+        }
+    }
+}
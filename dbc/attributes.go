@@ -0,0 +1,106 @@
+package dbc
+
+import (
+    "fmt"
+    "strconv"
+)
+
+// AttributeDef returns the BA_DEF_ definition called name, or nil
+func (f *DBCFile) AttributeDef(name string) *AttributeDefinition {
+    for i := range f.Attributes {
+        if f.Attributes[i].Name == name {
+            return &f.Attributes[i]
+        }
+    }
+    return nil
+}
+
+// AttributeValueFor returns the explicit BA_ assignment of attrName on the
+// given object, if there is one. objectType is "" for network attributes,
+// otherwise "BU_", "BO_", "SG_" or "EV_"; objectName follows AttributeValue.
+func (f *DBCFile) AttributeValueFor(objectType, objectName, attrName string) (string, bool) {
+    for _, av := range f.AttrValues {
+        if av.AttrName == attrName && av.ObjectType == objectType && av.ObjectName == objectName {
+            return av.Value, true
+        }
+    }
+    return "", false
+}
+
+// EffectiveAttribute returns the value a tool would actually use for
+// attrName on the given object: the BA_ override if present, otherwise the
+// BA_DEF_DEF_ default. ENUM values are resolved to their label.
+func (f *DBCFile) EffectiveAttribute(objectType, objectName, attrName string) (string, error) {
+    def := f.AttributeDef(attrName)
+    if def == nil {
+        return "", fmt.Errorf("attribute %q is not defined", attrName)
+    }
+    if !def.appliesTo(objectType) {
+        return "", fmt.Errorf("attribute %q does not apply to %q objects", attrName, objectType)
+    }
+    value, ok := f.AttributeValueFor(objectType, objectName, attrName)
+    if !ok {
+        value = def.DefaultValue
+    }
+    return def.enumLabel(value), nil
+}
+
+// NetworkAttribute is EffectiveAttribute for a network-level attribute
+func (f *DBCFile) NetworkAttribute(attrName string) (string, error) {
+    return f.EffectiveAttribute("", "", attrName)
+}
+
+// NodeAttribute is EffectiveAttribute for a BU_ node
+func (f *DBCFile) NodeAttribute(node, attrName string) (string, error) {
+    return f.EffectiveAttribute("BU_", node, attrName)
+}
+
+// MessageAttribute is EffectiveAttribute for the BO_ with the given raw ID
+func (f *DBCFile) MessageAttribute(id uint32, attrName string) (string, error) {
+    return f.EffectiveAttribute("BO_", strconv.FormatUint(uint64(id), 10), attrName)
+}
+
+// SignalAttribute is EffectiveAttribute for a signal of the BO_ with the given raw ID
+func (f *DBCFile) SignalAttribute(id uint32, signal, attrName string) (string, error) {
+    return f.EffectiveAttribute("SG_", strconv.FormatUint(uint64(id), 10)+" "+signal, attrName)
+}
+
+// sameType reports whether two definitions have the same type and range
+func (d *AttributeDefinition) sameType(o *AttributeDefinition) bool {
+    if d.DataType != o.DataType || d.Minimum != o.Minimum || d.Maximum != o.Maximum ||
+        len(d.EnumValues) != len(o.EnumValues) {
+        return false
+    }
+    for i := range d.EnumValues {
+        if d.EnumValues[i] != o.EnumValues[i] {
+            return false
+        }
+    }
+    return true
+}
+
+// appliesTo reports whether the definition is valid for objectType
+func (d *AttributeDefinition) appliesTo(objectType string) bool {
+    if len(d.AppliesTo) == 0 {
+        return objectType == ""
+    }
+    for _, t := range d.AppliesTo {
+        if t == objectType {
+            return true
+        }
+    }
+    return false
+}
+
+// enumLabel maps an ENUM index (as written in BA_) to its label. Values that
+// are already labels, or belong to non-ENUM attributes, are returned as-is.
+func (d *AttributeDefinition) enumLabel(value string) string {
+    if d.DataType != AttrEnum {
+        return value
+    }
+    idx, err := strconv.Atoi(value)
+    if err != nil || idx < 0 || idx >= len(d.EnumValues) {
+        return value
+    }
+    return d.EnumValues[idx]
+}
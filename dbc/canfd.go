@@ -0,0 +1,209 @@
+package dbc
+
+import (
+    "strconv"
+    "strings"
+)
+
+// Attributes Vector tools use to mark CAN FD frames
+const (
+    attrFrameFormat = "VFrameFormat"
+    attrBRS         = "CANFD_BRS"
+)
+
+// frameFormatLabels is the VFrameFormat ENUM as defined by CANdb++
+var frameFormatLabels = []string{
+    "StandardCAN", "ExtendedCAN", "reserved", "J1939PG",
+    "reserved", "reserved", "reserved", "reserved",
+    "reserved", "reserved", "reserved", "reserved",
+    "reserved", "reserved", "StandardCAN_FD", "ExtendedCAN_FD",
+}
+
+// frameFormatFor is the VFrameFormat label for {IsFD, IsExtended}
+var frameFormatFor = map[[2]bool]string{
+    {false, false}: "StandardCAN",
+    {false, true}:  "ExtendedCAN",
+    {true, false}:  "StandardCAN_FD",
+    {true, true}:   "ExtendedCAN_FD",
+}
+
+// fdPayloadLengths are the payload sizes a CAN FD DLC can encode beyond 8 bytes,
+// indexed by DLC code - 9
+var fdPayloadLengths = []int{12, 16, 20, 24, 32, 48, 64}
+
+// ValidPayloadLength reports whether n bytes is a legal payload size for a
+// classic CAN frame, or for a CAN FD frame if fd is set
+func ValidPayloadLength(n int, fd bool) bool {
+    if n >= 0 && n <= 8 {
+        return true
+    }
+    if !fd {
+        return false
+    }
+    for _, l := range fdPayloadLengths {
+        if l == n {
+            return true
+        }
+    }
+    return false
+}
+
+// PayloadSize returns the frame payload in bytes. The BO_ size is normally
+// the byte count, but some tools write the raw CAN FD DLC code instead.
+// Codes 9–11 and 13–15 are mapped to their byte count here; 12 is a valid
+// byte count itself and is kept.
+func (m *Message) PayloadSize() int {
+    if m.IsFD && m.DLC > 8 && m.DLC <= 15 && m.DLC != 12 {
+        return fdPayloadLengths[m.DLC-9]
+    }
+    return m.DLC
+}
+
+// isFDFrameFormat reports whether a VFrameFormat label denotes CAN FD
+func isFDFrameFormat(label string) bool {
+    return strings.HasSuffix(label, "_FD")
+}
+
+// applyFrameFormats sets IsFD and BRS on every message from the effective
+// VFrameFormat and CANFD_BRS attribute values
+func (f *DBCFile) applyFrameFormats() {
+    format := f.AttributeDef(attrFrameFormat)
+    brs := f.AttributeDef(attrBRS)
+    idx := indexFrameFormats(f.AttrValues)
+    for i := range f.Messages {
+        m := &f.Messages[i]
+        if format != nil {
+            m.IsFD = isFDFrameFormat(idx.label(f.AttrValues, format, m.RawID()))
+        }
+        if brs != nil && m.IsFD {
+            m.BRS = idx.label(f.AttrValues, brs, m.RawID()) == "1"
+        }
+    }
+}
+
+// frameFormatAttributes returns the attribute definitions and values to
+// write, with VFrameFormat and CANFD_BRS brought in line with each
+// message's IsFD and BRS flags. The DBCFile itself is not modified.
+func (f *DBCFile) frameFormatAttributes() ([]AttributeDefinition, []AttributeValue) {
+    defs := append([]AttributeDefinition(nil), f.Attributes...)
+    values := append([]AttributeValue(nil), f.AttrValues...)
+
+    anyFD, anyBRS := false, false
+    for _, m := range f.Messages {
+        anyFD = anyFD || m.IsFD
+        anyBRS = anyBRS || m.IsFD && m.BRS
+    }
+    if anyFD && f.AttributeDef(attrFrameFormat) == nil {
+        defs = append(defs, AttributeDefinition{
+            Name:         attrFrameFormat,
+            DataType:     AttrEnum,
+            AppliesTo:    []string{"BO_"},
+            DefaultValue: "StandardCAN",
+            EnumValues:   frameFormatLabels,
+        })
+    }
+    if anyBRS && f.AttributeDef(attrBRS) == nil {
+        defs = append(defs, AttributeDefinition{
+            Name:         attrBRS,
+            DataType:     AttrEnum,
+            AppliesTo:    []string{"BO_"},
+            DefaultValue: "1",
+            EnumValues:   []string{"0", "1"},
+        })
+    }
+
+    // look definitions up in the extended list so newly added ones apply
+    out := &DBCFile{Messages: f.Messages, Attributes: defs, AttrValues: values}
+    idx := indexFrameFormats(values)
+    for _, m := range f.Messages {
+        if fd := out.AttributeDef(attrFrameFormat); fd != nil {
+            current := f.effectiveOrDefault(idx, fd, m.RawID())
+            want := current
+            if isFDFrameFormat(current) != m.IsFD {
+                want = frameFormatFor[[2]bool{m.IsFD, m.IsExtended}]
+            }
+            out.setMessageAttribute(idx, fd, m.RawID(), want)
+        }
+        if brs := out.AttributeDef(attrBRS); brs != nil && m.IsFD {
+            want := "0"
+            if m.BRS {
+                want = "1"
+            }
+            out.setMessageAttribute(idx, brs, m.RawID(), want)
+        }
+    }
+    return out.Attributes, out.AttrValues
+}
+
+// frameFormatIndex locates the BO_ values of VFrameFormat and CANFD_BRS in
+// AttrValues by "<attribute> <raw ID>", so files with thousands of
+// messages are not scanned once per message
+type frameFormatIndex map[string]int
+
+func indexFrameFormats(values []AttributeValue) frameFormatIndex {
+    idx := frameFormatIndex{}
+    for i, av := range values {
+        if av.ObjectType != "BO_" || av.AttrName != attrFrameFormat && av.AttrName != attrBRS {
+            continue
+        }
+        // the first assignment wins, as in AttributeValueFor
+        if _, ok := idx[av.AttrName+" "+av.ObjectName]; !ok {
+            idx[av.AttrName+" "+av.ObjectName] = i
+        }
+    }
+    return idx
+}
+
+func frameFormatKey(def *AttributeDefinition, rawID uint32) string {
+    return def.Name + " " + strconv.FormatUint(uint64(rawID), 10)
+}
+
+// label is MessageAttribute for def, looked up through the index
+func (idx frameFormatIndex) label(values []AttributeValue, def *AttributeDefinition, rawID uint32) string {
+    if i, ok := idx[frameFormatKey(def, rawID)]; ok {
+        return def.enumLabel(values[i].Value)
+    }
+    return def.enumLabel(def.DefaultValue)
+}
+
+// effectiveOrDefault is MessageAttribute for a definition that may not be
+// part of f yet, in which case its default applies
+func (f *DBCFile) effectiveOrDefault(idx frameFormatIndex, def *AttributeDefinition, rawID uint32) string {
+    if f.AttributeDef(def.Name) == nil {
+        return def.enumLabel(def.DefaultValue)
+    }
+    return idx.label(f.AttrValues, def, rawID)
+}
+
+// setMessageAttribute makes the effective value of def on the message with
+// rawID equal to label, writing an explicit BA_ only when it differs from
+// the default
+func (f *DBCFile) setMessageAttribute(idx frameFormatIndex, def *AttributeDefinition, rawID uint32, label string) {
+    name := strconv.FormatUint(uint64(rawID), 10)
+    value := label
+    if def.DataType == AttrEnum {
+        for i, v := range def.EnumValues {
+            if v == label {
+                value = strconv.Itoa(i)
+                break
+            }
+        }
+    }
+
+    key := frameFormatKey(def, rawID)
+    if i, ok := idx[key]; ok {
+        if def.enumLabel(f.AttrValues[i].Value) != label {
+            f.AttrValues[i].Value = value
+        }
+        return
+    }
+    if def.enumLabel(def.DefaultValue) != label {
+        idx[key] = len(f.AttrValues)
+        f.AttrValues = append(f.AttrValues, AttributeValue{
+            ObjectType: "BO_",
+            ObjectName: name,
+            AttrName:   def.Name,
+            Value:      value,
+        })
+    }
+}
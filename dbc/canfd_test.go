@@ -0,0 +1,114 @@
+package dbc
+
+import "testing"
+
+func TestValidPayloadLength(t *testing.T) {
+    for n := -1; n <= 65; n++ {
+        wantCAN := n >= 0 && n <= 8
+        wantFD := wantCAN
+        switch n {
+        case 12, 16, 20, 24, 32, 48, 64:
+            wantFD = true
+        }
+        if got := ValidPayloadLength(n, false); got != wantCAN {
+            t.Errorf("ValidPayloadLength(%d, false) = %v", n, got)
+        }
+        if got := ValidPayloadLength(n, true); got != wantFD {
+            t.Errorf("ValidPayloadLength(%d, true) = %v", n, got)
+        }
+    }
+}
+
+func TestPayloadSize(t *testing.T) {
+    tests := []struct {
+        dlc  int
+        fd   bool
+        want int
+    }{
+        {0, false, 0},
+        {8, false, 8},
+        {9, false, 9}, // classic frames keep the byte count as written
+        {8, true, 8},
+        {9, true, 12},
+        {12, true, 12}, // a byte count, not DLC code 12 (24 bytes)
+        {13, true, 32},
+        {15, true, 64},
+        {16, true, 16}, // already a byte count
+        {64, true, 64},
+    }
+    for _, tt := range tests {
+        m := Message{DLC: tt.dlc, IsFD: tt.fd}
+        if got := m.PayloadSize(); got != tt.want {
+            t.Errorf("PayloadSize of DLC %d (fd %v) = %d, want %d", tt.dlc, tt.fd, got, tt.want)
+        }
+    }
+}
+
+const canFDSample = `BU_: ECU1
+
+BO_ 100 Classic: 8 ECU1
+ SG_ A : 0|8@1+ (1,0) [0|255] "" ECU1
+
+BO_ 200 Fast: 64 ECU1
+ SG_ B : 504|8@1+ (1,0) [0|255] "" ECU1
+
+BO_ 2147484160 FastExt: 15 ECU1
+ SG_ C : 0|8@1+ (1,0) [0|255] "" ECU1
+
+BA_DEF_ BO_ "VFrameFormat" ENUM "StandardCAN","ExtendedCAN","reserved","J1939PG","reserved","reserved","reserved","reserved","reserved","reserved","reserved","reserved","reserved","reserved","StandardCAN_FD","ExtendedCAN_FD";
+BA_DEF_ BO_ "CANFD_BRS" ENUM "0","1";
+BA_DEF_DEF_ "VFrameFormat" "StandardCAN";
+BA_DEF_DEF_ "CANFD_BRS" "1";
+BA_ "VFrameFormat" BO_ 200 14;
+BA_ "CANFD_BRS" BO_ 200 0;
+BA_ "VFrameFormat" BO_ 2147484160 15;
+`
+
+func TestParseCANFD(t *testing.T) {
+    f := mustParse(t, canFDSample)
+    tests := []struct {
+        id       uint32
+        fd, brs bool
+        size    int
+    }{
+        {100, false, false, 8},
+        {200, true, false, 64},
+        {0x80000200, true, true, 64},
+    }
+    for i, f := range []*DBCFile{f, roundTrip(t, f)} {
+        for _, tt := range tests {
+            m := f.MessageByID(tt.id)
+            if m.IsFD != tt.fd || m.BRS != tt.brs || m.PayloadSize() != tt.size {
+                t.Errorf("pass %d: %s: fd %v brs %v size %d, want %v %v %d", i, m.Name, m.IsFD, m.BRS, m.PayloadSize(), tt.fd, tt.brs, tt.size)
+            }
+        }
+        if err := f.Validate(); err != nil {
+            t.Errorf("pass %d: %v", i, err)
+        }
+    }
+
+    // flags set on the model are written as attributes
+    f.MessageByID(100).IsFD = true
+    f.MessageByID(200).BRS = true
+    got := roundTrip(t, f)
+    if m := got.MessageByID(100); !m.IsFD || m.BRS {
+        t.Errorf("Classic after edit: fd %v brs %v", m.IsFD, m.BRS)
+    }
+    if m := got.MessageByID(200); !m.IsFD || !m.BRS {
+        t.Errorf("Fast after edit: fd %v brs %v", m.IsFD, m.BRS)
+    }
+    if v, _ := got.MessageAttribute(100, "VFrameFormat"); v != "StandardCAN_FD" {
+        t.Errorf("VFrameFormat of Classic = %q", v)
+    }
+
+    // a file without the definitions gains them on save
+    plain := mustParse(t, "BU_: ECU1\nBO_ 2147484160 Ext: 8 ECU1\n")
+    plain.Messages[0].IsFD = true
+    got = roundTrip(t, plain)
+    if !got.Messages[0].IsFD {
+        t.Error("IsFD lost without a VFrameFormat definition")
+    }
+    if v, _ := got.MessageAttribute(0x80000200, "VFrameFormat"); v != "ExtendedCAN_FD" {
+        t.Errorf("VFrameFormat = %q, want ExtendedCAN_FD", v)
+    }
+}
@@ -0,0 +1,173 @@
+package dbc
+
+import (
+    "fmt"
+    "strings"
+)
+
+// statementRank orders the statements of a DBC file the way the Vector DBC
+// format specification lays them out. Statements of equal rank may be
+// mixed; tools disagree on the order of the last few.
+var statementRank = map[string]int{
+    "VERSION":          0,
+    "NS_":              1,
+    "BS_":              2,
+    "BU_":              3,
+    "VAL_TABLE_":       4,
+    "BO_":              5,
+    "SG_":              5,
+    "BO_TX_BU_":        6,
+    "EV_":              7,
+    "ENVVAR_DATA_":     8,
+    "EV_DATA_":         8,
+    "SGTYPE_":          9,
+    "CM_":              10,
+    "BA_DEF_":          11,
+    "BA_DEF_SGTYPE_":   11,
+    "BA_DEF_REL_":      11,
+    "BA_DEF_DEF_":      12,
+    "BA_DEF_DEF_REL_":  12,
+    "BA_":              13,
+    "BA_SGTYPE_":       13,
+    "BA_REL_":          13,
+    "BU_SG_REL_":       13,
+    "BU_EV_REL_":       13,
+    "BU_BO_REL_":       13,
+    "VAL_":             14,
+    "SGTYPE_VAL_":      14,
+    "CAT_DEF_":         15,
+    "CAT_":             15,
+    "FILTER":           15,
+    "SIG_TYPE_REF_":    16,
+    "SIG_GROUP_":       16,
+    "SIG_VALTYPE_":     16,
+    "SIGTYPE_VALTYPE_": 16,
+    "SG_MUL_VAL_":      17,
+}
+
+// requiredSections must appear in every file
+var requiredSections = []string{"BS_", "BU_"}
+
+// semicolon says whether a statement must (true) or must not (false) end
+// in ";". BS_ is obsolete and not checked.
+var semicolon = map[string]bool{
+    "VERSION":         false,
+    "NS_":             false,
+    "BU_":             false,
+    "BO_":             false,
+    "SG_":             false,
+    "VAL_TABLE_":      true,
+    "BO_TX_BU_":       true,
+    "EV_":             true,
+    "ENVVAR_DATA_":    true,
+    "CM_":             true,
+    "BA_DEF_":         true,
+    "BA_DEF_REL_":     true,
+    "BA_DEF_DEF_":     true,
+    "BA_DEF_DEF_REL_": true,
+    "BA_":             true,
+    "BA_REL_":         true,
+    "BU_SG_REL_":      true,
+    "BU_EV_REL_":      true,
+    "BU_BO_REL_":      true,
+    "VAL_":            true,
+    "SIG_GROUP_":      true,
+    "SIG_VALTYPE_":    true,
+    "SG_MUL_VAL_":     true,
+}
+
+// namespaceOnly are NS_ symbols that are not statement keywords
+var namespaceOnly = []string{"NS_DESC_"}
+
+// independentSignalsMsg is the pseudo-message CANdb++ keeps signals that
+// belong to no frame in; its ID is out of range on purpose
+const independentSignalsMsg = "VECTOR__INDEPENDENT_SIG_MSG"
+
+// deviatef records a deviation from the DBC grammar at token t, or at the
+// start of the statement if t has no position. Outside strict mode it does
+// nothing.
+func (p *Parser) deviatef(t token, format string, args ...any) {
+    if !p.opts.Strict {
+        return
+    }
+    p.deviations = append(p.deviations, &codedError{
+        CodeNonconformant,
+        &posError{t.line, t.col, fmt.Errorf(format, args...)},
+    })
+}
+
+// checkStatement checks the keyword, position and terminator of a
+// statement against the grammar
+func (p *Parser) checkStatement(key, stmt string) {
+    if !p.opts.Strict {
+        return
+    }
+    rank, ok := statementRank[key]
+    if !ok {
+        p.deviatef(token{}, "unknown keyword %q", key)
+        return
+    }
+
+    for _, req := range requiredSections {
+        if statementRank[req] < rank && !p.seen[req] {
+            p.deviatef(token{}, "missing %s: before %s", req, key)
+            p.seen[req] = true // report it once
+        }
+    }
+    if rank < p.rank {
+        p.deviatef(token{}, "%s must come before %s", key, p.rankKey)
+    } else {
+        p.rank, p.rankKey = rank, key
+    }
+    p.seen[key] = true
+
+    if want, ok := semicolon[key]; ok && strings.HasSuffix(stmt, ";") != want {
+        // point at the end of the statement
+        lines := strings.Split(stmt, "\n")
+        end := token{line: int32(len(lines)), col: int32(len(lines[len(lines)-1]))}
+        if want {
+            end.col++
+            p.deviatef(end, "%s must end with \";\"", key)
+        } else {
+            p.deviatef(end, "unexpected \";\" after %s", key)
+        }
+    }
+}
+
+// checkEnd reports required sections the file never reached
+func (p *Parser) checkEnd() {
+    if !p.opts.Strict || p.stmtLine == 0 {
+        return
+    }
+    for _, req := range requiredSections {
+        if !p.seen[req] {
+            p.deviatef(token{}, "missing %s: section", req)
+        }
+    }
+}
+
+// checkNamespaceSymbol flags an NS_ entry that is not a DBC keyword
+func (p *Parser) checkNamespaceSymbol(sym string) {
+    if _, ok := statementRank[sym]; !ok && !contains(namespaceOnly, sym) {
+        p.deviatef(token{}, "unknown NS_ symbol %q", sym)
+    }
+}
+
+// checkNode flags a node reference that is neither declared on BU_ nor
+// the Vector__XXX placeholder
+func (p *Parser) checkNode(t token, what string) {
+    if p.opts.Strict && t.text != "Vector__XXX" && !p.hasNode(t.text) {
+        p.deviatef(t, "%s %q is not declared in BU_", what, t.text)
+    }
+}
+
+// checkMessageID flags IDs that do not fit a standard (11-bit) or
+// extended (29-bit) frame
+func (p *Parser) checkMessageID(t token, msg *Message) {
+    switch {
+    case !msg.IsExtended && msg.ID > 0x7FF:
+        p.deviatef(t, "message ID %d does not fit 11 bits; set bit 31 for an extended frame", msg.ID)
+    case msg.IsExtended && msg.ID > 0x1FFFFFFF && msg.Name != independentSignalsMsg:
+        p.deviatef(t, "extended message ID %d does not fit 29 bits", msg.ID)
+    }
+}
@@ -0,0 +1,145 @@
+package dbc
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+    "unicode"
+)
+
+// Severity grades a Diagnostic
+type Severity int
+
+const (
+    // SeverityError marks a statement that was skipped, or in strict mode
+    // one that does not conform to the DBC grammar
+    SeverityError Severity = iota
+    // SeverityWarning marks a statement that was skipped only because of
+    // an earlier error, or input that was probably decoded wrongly
+    SeverityWarning
+)
+
+func (s Severity) String() string {
+    if s == SeverityWarning {
+        return "warning"
+    }
+    return "error"
+}
+
+// Diagnostic codes
+const (
+    CodeSyntax             = "syntax"              // malformed statement
+    CodeUnknownReference   = "unknown-reference"   // names an undefined message, signal, node, ...
+    CodeUnterminatedString = "unterminated-string" // quoted string still open at end of file
+    CodeOrphanSignal       = "orphan-signal"       // SG_ whose BO_ was skipped
+    CodeNonconformant      = "nonconformant"       // accepted, but not valid DBC; strict mode only
+    CodeInvalid            = "invalid"             // parsed, but rejected by DBCFile.Validate
+    CodeEncoding           = "encoding"            // the detected encoding is probably wrong
+)
+
+// Diagnostic is one problem found while parsing. Line and Column are
+// 1-based and point into the source file.
+type Diagnostic struct {
+    Line     int      `json:"line"`
+    Column   int      `json:"column"`
+    Severity Severity `json:"severity"`
+    Code     string   `json:"code"`
+    Message  string   `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+    return fmt.Sprintf("%d:%d: %s: %s [%s]", d.Line, d.Column, d.Severity, d.Message, d.Code)
+}
+
+// ParseOptions controls how a Parser treats malformed input
+type ParseOptions struct {
+    // Lenient skips malformed statements instead of failing, records a
+    // Diagnostic for each in DBCFile.Diagnostics and returns the rest of
+    // the file
+    Lenient bool
+
+    // Strict reports every deviation from the Vector DBC grammar that is
+    // otherwise tolerated, e.g. unknown keywords, statements out of order,
+    // a missing ";" or undeclared nodes, with CodeNonconformant. Combine
+    // with Lenient to list them all instead of failing at the first.
+    Strict bool
+
+    // FileName is recorded in the SourceSpan of every parsed object
+    FileName string
+
+    // KeepSource keeps the original text of the file with the DBCFile, so
+    // SaveOptions.PreserveFormatting can write unchanged statements as
+    // they were. It costs memory in proportion to the file size, and such
+    // a save parses the text again to find what was edited.
+    KeepSource bool
+
+    // Encoding of the input; EncodingAuto detects it
+    Encoding Encoding
+}
+
+// codedError tags a parse error with its diagnostic code
+type codedError struct {
+    code string
+    err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+// referenceErrorf reports a statement naming an object that is not defined
+func referenceErrorf(format string, args ...any) error {
+    return &codedError{CodeUnknownReference, fmt.Errorf(format, args...)}
+}
+
+// diagnose turns the error of the statement that starts at p.stmtLine into
+// a Diagnostic, locating it as precisely as the error allows
+func (p *Parser) diagnose(err error) Diagnostic {
+    d := Diagnostic{
+        Line:     p.stmtLine,
+        Column:   p.stmtColumn(),
+        Severity: SeverityError,
+        Code:     CodeSyntax,
+        Message:  err.Error(),
+    }
+    var coded *codedError
+    if errors.As(err, &coded) {
+        d.Code = coded.code
+        if d.Code == CodeOrphanSignal {
+            d.Severity = SeverityWarning
+        }
+    }
+    var pos *posError
+    if errors.As(err, &pos) && pos.line > 0 {
+        d.Line = p.stmtLine + int(pos.line) - 1
+        d.Column = int(pos.col)
+        if pos.line == 1 {
+            // the first line was trimmed before lexing
+            d.Column += p.stmtColumn() - 1
+        }
+    }
+    return d
+}
+
+// span locates the statement being dispatched, from its first non-blank
+// character to its last
+func (p *Parser) span() SourceSpan {
+    last := strings.TrimRightFunc(p.lastLine, unicode.IsSpace)
+    return SourceSpan{
+        File:      p.opts.FileName,
+        Line:      p.stmtLine,
+        Column:    p.stmtColumn(),
+        EndLine:   p.lineNo,
+        EndColumn: len(last),
+    }
+}
+
+// stmtColumn is the column the current statement starts at
+func (p *Parser) stmtColumn() int {
+    line := p.firstLine
+    for i := 0; i < len(line); i++ {
+        if !isSpace(line[i]) {
+            return i + 1
+        }
+    }
+    return 1
+}
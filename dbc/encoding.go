@@ -0,0 +1,257 @@
+package dbc
+
+import (
+    "bufio"
+    "bytes"
+    "fmt"
+    "io"
+    "unicode/utf8"
+
+    "golang.org/x/text/encoding"
+    "golang.org/x/text/encoding/charmap"
+    "golang.org/x/text/encoding/japanese"
+    "golang.org/x/text/encoding/unicode"
+    "golang.org/x/text/transform"
+)
+
+// Encoding is the character encoding of a DBC file. The model always holds
+// UTF-8; files are converted on load and save.
+type Encoding string
+
+const (
+    EncodingAuto     Encoding = ""             // detect on load; on save, the file's own encoding
+    EncodingUTF8     Encoding = "utf-8"
+    EncodingUTF8BOM  Encoding = "utf-8-bom"    // UTF-8 with a byte order mark
+    EncodingUTF16LE  Encoding = "utf-16le"     // written with a byte order mark
+    EncodingUTF16BE  Encoding = "utf-16be"     // written with a byte order mark
+    EncodingCP1252   Encoding = "windows-1252" // what CANdb++ writes on western Windows
+    EncodingLatin1   Encoding = "iso-8859-1"
+    EncodingShiftJIS Encoding = "shift_jis"
+)
+
+// Encodings lists the supported encodings, for pickers
+var Encodings = []Encoding{
+    EncodingUTF8, EncodingUTF8BOM, EncodingUTF16LE, EncodingUTF16BE,
+    EncodingCP1252, EncodingLatin1, EncodingShiftJIS,
+}
+
+// sniffSize is how much of the input detection looks at
+const sniffSize = 64 * 1024
+
+func (e Encoding) encoding() (encoding.Encoding, error) {
+    switch e {
+    case EncodingUTF8:
+        return unicode.UTF8, nil
+    case EncodingUTF8BOM:
+        return unicode.UTF8BOM, nil
+    case EncodingUTF16LE:
+        return unicode.UTF16(unicode.LittleEndian, unicode.UseBOM), nil
+    case EncodingUTF16BE:
+        return unicode.UTF16(unicode.BigEndian, unicode.UseBOM), nil
+    case EncodingCP1252:
+        return charmap.Windows1252, nil
+    case EncodingLatin1:
+        return charmap.ISO8859_1, nil
+    case EncodingShiftJIS:
+        return japanese.ShiftJIS, nil
+    }
+    return nil, fmt.Errorf("unsupported encoding %q", string(e))
+}
+
+// detectEncoding guesses the encoding from the start of a file: a byte
+// order mark decides, NUL bytes mean UTF-16, valid UTF-8 is taken as such
+// and anything else is assumed to be Windows-1252. Shift-JIS cannot be told
+// apart reliably and has to be chosen by the caller; decodeInput only
+// warns when the text looks like it.
+func detectEncoding(head []byte, complete bool) Encoding {
+    switch {
+    case bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}):
+        return EncodingUTF8BOM
+    case bytes.HasPrefix(head, []byte{0xFF, 0xFE}):
+        return EncodingUTF16LE
+    case bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+        return EncodingUTF16BE
+    }
+
+    // ASCII text in UTF-16 has a NUL in every other byte
+    var evenNUL, oddNUL int
+    for i, b := range head {
+        if b == 0 {
+            if i%2 == 0 {
+                evenNUL++
+            } else {
+                oddNUL++
+            }
+        }
+    }
+    switch {
+    case oddNUL > len(head)/4:
+        return EncodingUTF16LE
+    case evenNUL > len(head)/4:
+        return EncodingUTF16BE
+    }
+
+    if !complete && len(head) > 0 {
+        // the sample may end inside a multi-byte sequence
+        if i := lastRuneStart(head); !utf8.FullRune(head[i:]) {
+            head = head[:i]
+        }
+    }
+    if utf8.Valid(head) {
+        return EncodingUTF8
+    }
+    return EncodingCP1252
+}
+
+// lastRuneStart returns the index of the first byte of the last
+// (possibly incomplete) UTF-8 sequence in b
+func lastRuneStart(b []byte) int {
+    i := len(b) - 1
+    for i > 0 && !utf8.RuneStart(b[i]) {
+        i--
+    }
+    return i
+}
+
+// decodeInput returns r converted to UTF-8, detecting the encoding when
+// enc is EncodingAuto. The diagnostics warn about a detection that is
+// likely wrong.
+func decodeInput(r io.Reader, enc Encoding) (io.Reader, Encoding, []Diagnostic, error) {
+    br := bufio.NewReaderSize(r, sniffSize)
+    auto := enc == EncodingAuto
+    var diags []Diagnostic
+    if auto {
+        head, err := br.Peek(sniffSize)
+        if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+            return nil, enc, nil, err
+        }
+        enc = detectEncoding(head, err == io.EOF)
+        if enc == EncodingCP1252 {
+            if line, col := shiftJISPair(head); line > 0 {
+                diags = append(diags, Diagnostic{
+                    Line:     line,
+                    Column:   col,
+                    Severity: SeverityWarning,
+                    Code:     CodeEncoding,
+                    Message:  "read as Windows-1252, but the text looks like Shift-JIS; open it with that encoding",
+                })
+            }
+        }
+    }
+    e, err := enc.encoding()
+    if err != nil {
+        return nil, enc, nil, err
+    }
+    if enc == EncodingUTF8 {
+        if auto {
+            // only the start was checked
+            return &utf8Fallback{r: br}, enc, nil, nil
+        }
+        return br, enc, nil, nil
+    }
+    return transform.NewReader(br, e.NewDecoder()), enc, diags, nil
+}
+
+// shiftJISPair returns the 1-based line and column of the first Shift-JIS
+// double-byte character in head, or 0, 0 if head is not plausibly
+// Shift-JIS. Every non-ASCII byte must be part of a valid sequence, and
+// one pair must have a non-ASCII trail byte: a Windows-1252 "ä" followed
+// by a letter is a valid pair too.
+func shiftJISPair(head []byte) (line, col int) {
+    isLead := func(b byte) bool { return b >= 0x81 && b <= 0x9F || b >= 0xE0 && b <= 0xEF }
+    isTrail := func(b byte) bool { return b >= 0x40 && b <= 0xFC && b != 0x7F }
+    found, highTrail := -1, false
+    for i := 0; i < len(head); i++ {
+        b := head[i]
+        switch {
+        case b < 0x80, b >= 0xA1 && b <= 0xDF:
+            // ASCII or half-width katakana
+        case isLead(b) && i+1 < len(head) && isTrail(head[i+1]):
+            if found < 0 {
+                found = i
+            }
+            highTrail = highTrail || head[i+1] >= 0x80
+            i++
+        case isLead(b) && i+1 == len(head):
+            // cut off by the end of the sample
+        default:
+            return 0, 0
+        }
+    }
+    if !highTrail {
+        return 0, 0
+    }
+    start := bytes.LastIndexByte(head[:found], '\n') + 1
+    return bytes.Count(head[:found], []byte{'\n'}) + 1, found - start + 1
+}
+
+// utf8Fallback passes UTF-8 through until it meets a byte sequence that is
+// not valid UTF-8, and decodes everything from there on as Windows-1252.
+// It catches Windows-1252 files whose first non-ASCII character comes
+// after the sample detectEncoding looked at. Text before the switch is
+// ASCII unless the file mixes both encodings.
+type utf8Fallback struct {
+    r        *bufio.Reader
+    checked  int       // bytes at the head of r already found valid
+    fallback io.Reader // Windows-1252 decoder over r, once switched
+}
+
+func (u *utf8Fallback) Read(p []byte) (int, error) {
+    if u.fallback == nil && u.checked == 0 {
+        buf, err := u.r.Peek(max(min(len(p), u.r.Size()), utf8.UTFMax))
+        if len(buf) == 0 {
+            return 0, err
+        }
+        n := validUTF8Prefix(buf)
+        if n < len(buf) && (utf8.FullRune(buf[n:]) || err != nil) {
+            // invalid, not just cut off by the end of buf
+            u.fallback = transform.NewReader(u.r, charmap.Windows1252.NewDecoder())
+        }
+        u.checked = n
+    }
+    if u.checked == 0 {
+        return u.fallback.Read(p)
+    }
+    n, err := u.r.Read(p[:min(len(p), u.checked)])
+    u.checked -= n
+    return n, err
+}
+
+// encoding is the encoding the input turned out to be in
+func (u *utf8Fallback) encoding() Encoding {
+    if u.fallback != nil {
+        return EncodingCP1252
+    }
+    return EncodingUTF8
+}
+
+// validUTF8Prefix returns the length of the longest prefix of b made of
+// complete, valid UTF-8 sequences
+func validUTF8Prefix(b []byte) int {
+    if utf8.Valid(b) {
+        return len(b)
+    }
+    i := 0
+    for i < len(b) {
+        if b[i] < utf8.RuneSelf {
+            i++
+            continue
+        }
+        r, size := utf8.DecodeRune(b[i:])
+        if r == utf8.RuneError && size == 1 {
+            return i
+        }
+        i += size
+    }
+    return i
+}
+
+// encodeOutput returns a writer converting UTF-8 to enc. The writer must
+// be closed to flush it.
+func encodeOutput(w io.Writer, enc Encoding) (io.WriteCloser, error) {
+    e, err := enc.encoding()
+    if err != nil {
+        return nil, err
+    }
+    return transform.NewWriter(w, e.NewEncoder()), nil
+}
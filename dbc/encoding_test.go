@@ -0,0 +1,173 @@
+package dbc
+
+import (
+    "bufio"
+    "bytes"
+    "io"
+    "strings"
+    "testing"
+    "testing/iotest"
+
+    "golang.org/x/text/encoding/japanese"
+    "golang.org/x/text/transform"
+)
+
+func TestEncodingRoundTrip(t *testing.T) {
+    text := "VERSION \"\"\n\nBO_ 100 M: 8 Vector__XXX\n" +
+        " SG_ T : 0|8@1+ (1,0) [0|255] \"°C\" Vector__XXX\n\n" +
+        "CM_ SG_ 100 T \"Kühlmittel\";\n"
+    tests := []struct {
+        enc  Encoding
+        hint Encoding // passed to the parser; EncodingAuto detects
+    }{
+        {EncodingUTF8, EncodingAuto},
+        {EncodingUTF8BOM, EncodingAuto},
+        {EncodingUTF16LE, EncodingAuto},
+        {EncodingUTF16BE, EncodingAuto},
+        {EncodingCP1252, EncodingAuto},
+        {EncodingLatin1, EncodingLatin1},
+        {EncodingShiftJIS, EncodingShiftJIS},
+    }
+    for _, tt := range tests {
+        src := text
+        if tt.enc == EncodingShiftJIS {
+            src = "VERSION \"\"\n\nCM_ \"温度センサ\";\n"
+        }
+        e, err := tt.enc.encoding()
+        if err != nil {
+            t.Fatal(err)
+        }
+        raw, _, err := transform.Bytes(e.NewEncoder(), []byte(src))
+        if err != nil {
+            t.Fatalf("%s: encode: %v", tt.enc, err)
+        }
+
+        f, err := NewParserWithOptions(ParseOptions{Encoding: tt.hint, KeepSource: true}).Parse(bytes.NewReader(raw))
+        if err != nil {
+            t.Fatalf("%s: %v", tt.enc, err)
+        }
+        if f.Encoding != tt.enc {
+            t.Errorf("%s: detected %s", tt.enc, f.Encoding)
+        }
+        if tt.enc != EncodingShiftJIS && f.Messages[0].Signals[0].Unit != "°C" {
+            t.Errorf("%s: unit decoded as %q", tt.enc, f.Messages[0].Signals[0].Unit)
+        }
+
+        var out bytes.Buffer
+        if _, err := f.WriteWithOptions(&out, SaveOptions{PreserveFormatting: true}); err != nil {
+            t.Fatalf("%s: write: %v", tt.enc, err)
+        }
+        if !bytes.Equal(out.Bytes(), raw) {
+            t.Errorf("%s: saved bytes differ from the input", tt.enc)
+        }
+    }
+}
+
+func TestEncodingUnsupportedCharacter(t *testing.T) {
+    f := &DBCFile{Comments: []Comment{{ObjectType: "CM_", Text: "Ω"}}}
+    var out bytes.Buffer
+    if _, err := f.WriteWithOptions(&out, SaveOptions{Encoding: EncodingCP1252}); err == nil {
+        t.Error("writing Ω as Windows-1252 did not fail")
+    }
+}
+
+func TestEncodingLateNonASCII(t *testing.T) {
+    // pure ASCII well past the detection sample, then CP1252 text
+    var src bytes.Buffer
+    src.Write(syntheticDBC(400, true))
+    if src.Len() <= sniffSize {
+        t.Fatalf("sample of %d bytes is not larger than %d", src.Len(), sniffSize)
+    }
+    src.WriteString("CM_ SG_ 100 Sig0 \"Temperatur in \xb0C, gro\xdf\";\n")
+
+    f, err := NewParserWithOptions(ParseOptions{KeepSource: true}).Parse(bytes.NewReader(src.Bytes()))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if f.Encoding != EncodingCP1252 {
+        t.Errorf("detected %s, want %s", f.Encoding, EncodingCP1252)
+    }
+    c := f.Comments[len(f.Comments)-1]
+    if c.Text != "Temperatur in °C, groß" {
+        t.Errorf("comment decoded as %q", c.Text)
+    }
+
+    // saving in the file's encoding gives back the original bytes
+    var out bytes.Buffer
+    if _, err := f.WriteWithOptions(&out, SaveOptions{PreserveFormatting: true}); err != nil {
+        t.Fatal(err)
+    }
+    if !bytes.Equal(out.Bytes(), src.Bytes()) {
+        t.Error("saved bytes differ from the input")
+    }
+}
+
+func TestUTF8Fallback(t *testing.T) {
+    tests := []struct {
+        in, want string
+        enc      Encoding
+    }{
+        {"plain", "plain", EncodingUTF8},
+        {"°C ß", "°C ß", EncodingUTF8},
+        {"ab\xb0C", "ab°C", EncodingCP1252},
+        {"ab\xc2", "abÂ", EncodingCP1252}, // truncated sequence at the end
+    }
+    for _, tt := range tests {
+        // one byte at a time, so sequences are split between reads
+        u := &utf8Fallback{r: bufio.NewReaderSize(iotest.OneByteReader(strings.NewReader(tt.in)), 16)}
+        got, err := io.ReadAll(iotest.OneByteReader(u))
+        if err != nil || string(got) != tt.want || u.encoding() != tt.enc {
+            t.Errorf("%q: got %q (%s), %v; want %q (%s)", tt.in, got, u.encoding(), err, tt.want, tt.enc)
+        }
+    }
+}
+
+func TestShiftJISBackslashTrailByte(t *testing.T) {
+    // "ソ" is 0x83 0x5C in Shift-JIS; read as Windows-1252 the 0x5C is a
+    // backslash escaping the closing quote
+    src := "VERSION \"\"\n\nBO_ 100 M: 8 Vector__XXX\n SG_ T : 0|8@1+ (1,0) [0|255] \"\" Vector__XXX\n\n" +
+        "CM_ SG_ 100 T \"温度センサ 電圧 ソ\";\n" +
+        "BO_ 200 N: 8 Vector__XXX\n"
+    raw, _, err := transform.Bytes(japanese.ShiftJIS.NewEncoder(), []byte(src))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !bytes.Contains(raw, []byte{0x83, 0x5C, '"'}) {
+        t.Fatal("test input does not end the comment in a 0x5C trail byte")
+    }
+
+    f, err := NewParserWithOptions(ParseOptions{Encoding: EncodingShiftJIS}).Parse(bytes.NewReader(raw))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(f.Messages) != 2 || len(f.Comments) != 1 || f.Comments[0].Text != "温度センサ 電圧 ソ" || len(f.Diagnostics) != 0 {
+        t.Errorf("got messages %v, comments %+v, diagnostics %v", f.Messages, f.Comments, f.Diagnostics)
+    }
+
+    f, err = NewParserWithOptions(ParseOptions{Lenient: true}).Parse(bytes.NewReader(raw))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(f.Diagnostics) == 0 || f.Diagnostics[0].Code != CodeEncoding || f.Diagnostics[0].Line != 6 || f.Diagnostics[0].Column != 16 {
+        t.Errorf("auto-detected: got diagnostics %v, want a Shift-JIS warning at 6:16", f.Diagnostics)
+    }
+}
+
+func TestShiftJISPair(t *testing.T) {
+    tests := []struct {
+        in        string
+        line, col int
+    }{
+        {"plain", 0, 0},
+        {"CM_ \"\x89\xb7\";", 1, 6},
+        {"a\nCM_ \"\x83\x5c\x89\xb7\";", 2, 6},
+        {"K\xfchlmittel gr\xf6\xdfer", 0, 0}, // Windows-1252
+        {"W\xe4rme \xb0C", 0, 0},             // valid pairs, but none with a non-ASCII trail byte
+        {"\x89\xb7\x89", 1, 1},               // sample ends inside a pair
+    }
+    for _, tt := range tests {
+        if line, col := shiftJISPair([]byte(tt.in)); line != tt.line || col != tt.col {
+            t.Errorf("%q: got %d:%d, want %d:%d", tt.in, line, col, tt.line, tt.col)
+        }
+    }
+}
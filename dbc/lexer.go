@@ -0,0 +1,308 @@
+package dbc
+
+import (
+    "fmt"
+    "strings"
+)
+
+// tokenKind classifies a lexical token of a DBC statement
+type tokenKind uint8
+
+const (
+    tokEOF tokenKind = iota
+    tokIdent   // keywords and names, e.g. "BO_", "EngineSpeed", "m1M"
+    tokNumber  // integer or float literal, optionally signed
+    tokString  // quoted string; text holds the unescaped contents
+    tokPunct   // single-character punctuation: : ; , | @ ( ) [ ] + -
+)
+
+// token is one lexical unit with its position (1-based) in the input
+type token struct {
+    kind tokenKind
+    text string
+    line int32 // int32 keeps tokens small, they are copied a lot
+    col  int32
+}
+
+func (t token) String() string {
+    switch t.kind {
+    case tokEOF:
+        return "end of statement"
+    case tokString:
+        return fmt.Sprintf("%q", t.text)
+    }
+    return t.text
+}
+
+// posError is an error at a token position within the statement, so
+// diagnostics can point at the offending column
+type posError struct {
+    line, col int32 // 0 when the statement ended early
+    err       error
+}
+
+func (e *posError) Error() string { return e.err.Error() }
+func (e *posError) Unwrap() error { return e.err }
+
+// lexer splits DBC source into tokens. Strings may span several lines and
+// use \" and \\ escapes, as written by Vector tools.
+type lexer struct {
+    src       string
+    pos       int
+    line      int
+    lineStart int // offset of the current line, for columns
+}
+
+// tokenize lexes all of src, appending the tokens to dst
+func tokenize(dst []token, src string) ([]token, error) {
+    lx := lexer{src: src, line: 1}
+    toks := dst
+    for {
+        // lex straight into the slice; copying tokens around is most of
+        // the cost of lexing
+        toks = append(toks, token{})
+        t := &toks[len(toks)-1]
+        if err := lx.next(t); err != nil {
+            return nil, err
+        }
+        if t.kind == tokEOF {
+            return toks[:len(toks)-1], nil
+        }
+    }
+}
+
+// headTokens lexes as many of the first tokens of src as fit in dst,
+// stopping early at the end or at a lexical error
+func headTokens(dst []token, src string) []token {
+    lx := lexer{src: src, line: 1}
+    toks := dst[:0]
+    for len(toks) < cap(toks) {
+        toks = append(toks, token{})
+        t := &toks[len(toks)-1]
+        if err := lx.next(t); err != nil || t.kind == tokEOF {
+            return toks[:len(toks)-1]
+        }
+    }
+    return toks
+}
+
+func (l *lexer) advance() byte {
+    c := l.src[l.pos]
+    l.pos++
+    if c == '\n' {
+        l.line++
+        l.lineStart = l.pos
+    }
+    return c
+}
+
+func (l *lexer) peekByte(off int) byte {
+    if l.pos+off >= len(l.src) {
+        return 0
+    }
+    return l.src[l.pos+off]
+}
+
+// next lexes the following token into tok, which is a tokEOF token at the
+// end of input
+func (l *lexer) next(tok *token) error {
+    for l.pos < len(l.src) && charClass[l.src[l.pos]] == classSpace {
+        if l.src[l.pos] == '\n' {
+            l.line++
+            l.lineStart = l.pos + 1
+        }
+        l.pos++
+    }
+    tok.line, tok.col = int32(l.line), int32(l.pos-l.lineStart+1)
+    if l.pos >= len(l.src) {
+        tok.kind = tokEOF
+        return nil
+    }
+
+    c := l.src[l.pos]
+    switch charClass[c] {
+    case classIdent:
+        // identifiers never contain a newline, so skip advance
+        start := l.pos
+        l.pos++
+        for l.pos < len(l.src) && charClass[l.src[l.pos]] >= classIdent {
+            l.pos++
+        }
+        tok.kind, tok.text = tokIdent, l.src[start:l.pos]
+        return nil
+    case classDigit:
+        l.lexNumber(tok)
+        return nil
+    case classQuote:
+        return l.lexString(tok)
+    case classSign:
+        if isDigit(l.peekByte(1)) || l.peekByte(1) == '.' && isDigit(l.peekByte(2)) {
+            l.lexNumber(tok)
+            return nil
+        }
+        if c == '.' {
+            break
+        }
+        fallthrough
+    case classPunct:
+        l.pos++
+        tok.kind, tok.text = tokPunct, l.src[l.pos-1:l.pos]
+        return nil
+    }
+    return &posError{tok.line, tok.col, fmt.Errorf("%d:%d: unexpected character %q", tok.line, tok.col, c)}
+}
+
+func (l *lexer) lexString(tok *token) error {
+    l.pos++ // opening quote
+    // without escapes or line breaks the contents are a slice of the input
+    if end := strings.IndexAny(l.src[l.pos:], "\"\\\n"); end >= 0 && l.src[l.pos+end] == '"' {
+        tok.kind, tok.text = tokString, l.src[l.pos:l.pos+end]
+        l.pos += end + 1
+        return nil
+    }
+    var sb strings.Builder
+    for l.pos < len(l.src) {
+        c := l.advance()
+        switch c {
+        case '"':
+            tok.kind, tok.text = tokString, sb.String()
+            return nil
+        case '\\':
+            if l.pos < len(l.src) && (l.src[l.pos] == '"' || l.src[l.pos] == '\\') {
+                c = l.advance()
+            }
+        }
+        sb.WriteByte(c)
+    }
+    return &posError{tok.line, tok.col, fmt.Errorf("%d:%d: unterminated string", tok.line, tok.col)}
+}
+
+func (l *lexer) lexNumber(tok *token) {
+    // numbers never contain a newline, so skip advance
+    start := l.pos
+    if c := l.src[l.pos]; c == '-' || c == '+' {
+        l.pos++
+    }
+    for l.pos < len(l.src) {
+        c := l.src[l.pos]
+        if isDigit(c) || c == '.' {
+            l.pos++
+            continue
+        }
+        // exponent, e.g. 1e-05
+        if (c == 'e' || c == 'E') && (isDigit(l.peekByte(1)) ||
+            (l.peekByte(1) == '-' || l.peekByte(1) == '+') && isDigit(l.peekByte(2))) {
+            l.pos += 2
+            continue
+        }
+        break
+    }
+    tok.kind, tok.text = tokNumber, l.src[start:l.pos]
+}
+
+// openAfter reports whether a quoted string is open at the end of s, given
+// whether one was open at its start. Statements spanning many lines are
+// checked line by line with it.
+func openAfter(s string, inString bool) bool {
+    if strings.IndexByte(s, '\\') < 0 {
+        return inString != (strings.Count(s, `"`)%2 == 1)
+    }
+    for i := 0; i < len(s); i++ {
+        switch s[i] {
+        case '\\':
+            if inString {
+                i++ // skip the escaped character
+            }
+        case '"':
+            inString = !inString
+        }
+    }
+    return inString
+}
+
+func isSpace(c byte) bool { return charClass[c] == classSpace }
+func isDigit(c byte) bool { return charClass[c] == classDigit }
+
+// character classes for the lexer; identifiers continue with any class
+// from classIdent on
+const (
+    classOther = iota
+    classSpace
+    classQuote
+    classPunct
+    classSign // + - . may also start a number
+    classIdent
+    classDigit
+)
+
+var charClass = func() (t [256]uint8) {
+    for _, c := range " \t\r\n" {
+        t[c] = classSpace
+    }
+    for _, c := range ":;,|@()[]" {
+        t[c] = classPunct
+    }
+    for _, c := range "+-." {
+        t[c] = classSign
+    }
+    for c := 'A'; c <= 'Z'; c++ {
+        t[c], t[c+'a'-'A'] = classIdent, classIdent
+    }
+    t['_'] = classIdent
+    for c := '0'; c <= '9'; c++ {
+        t[c] = classDigit
+    }
+    t['"'] = classQuote
+    return t
+}()
+
+// tokenStream is a cursor over the tokens of a single statement
+type tokenStream struct {
+    toks []token
+    pos  int
+}
+
+func (ts *tokenStream) peek() token {
+    if ts.pos >= len(ts.toks) {
+        return token{kind: tokEOF}
+    }
+    return ts.toks[ts.pos]
+}
+
+func (ts *tokenStream) next() token {
+    t := ts.peek()
+    if ts.pos < len(ts.toks) {
+        ts.pos++
+    }
+    return t
+}
+
+// accept consumes the next token if it is the punctuation or keyword text
+func (ts *tokenStream) accept(text string) bool {
+    if t := ts.peek(); (t.kind == tokPunct || t.kind == tokIdent) && t.text == text {
+        ts.pos++
+        return true
+    }
+    return false
+}
+
+// expect consumes a token of the given kind or returns an error
+func (ts *tokenStream) expect(kind tokenKind, what string) (token, error) {
+    t := ts.next()
+    if t.kind != kind {
+        return t, &posError{t.line, t.col, fmt.Errorf("expected %s, got %s", what, t)}
+    }
+    return t, nil
+}
+
+// errorf reports an error at the next token
+func (ts *tokenStream) errorf(format string, args ...any) error {
+    t := ts.peek()
+    return &posError{t.line, t.col, fmt.Errorf(format, args...)}
+}
+
+// atEnd reports whether only an optional terminating ";" remains
+func (ts *tokenStream) atEnd() bool {
+    ts.accept(";")
+    return ts.peek().kind == tokEOF
+}
@@ -0,0 +1,78 @@
+package dbc
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestTokenize(t *testing.T) {
+    tests := []struct {
+        src  string
+        want []token
+    }{
+        {`SG_ Speed : 0|16@1+ (0.01,-40) [-40|615.35] "km/h" ECU1`, []token{
+            {tokIdent, "SG_", 1, 1}, {tokIdent, "Speed", 1, 5}, {tokPunct, ":", 1, 11},
+            {tokNumber, "0", 1, 13}, {tokPunct, "|", 1, 14}, {tokNumber, "16", 1, 15},
+            {tokPunct, "@", 1, 17}, {tokNumber, "1", 1, 18}, {tokPunct, "+", 1, 19},
+            {tokPunct, "(", 1, 21}, {tokNumber, "0.01", 1, 22}, {tokPunct, ",", 1, 26},
+            {tokNumber, "-40", 1, 27}, {tokPunct, ")", 1, 30}, {tokPunct, "[", 1, 32},
+            {tokNumber, "-40", 1, 33}, {tokPunct, "|", 1, 36}, {tokNumber, "615.35", 1, 37},
+            {tokPunct, "]", 1, 43}, {tokString, "km/h", 1, 45}, {tokIdent, "ECU1", 1, 52},
+        }},
+        {`1e-05 -.5 +3 m1M`, []token{
+            {tokNumber, "1e-05", 1, 1}, {tokNumber, "-.5", 1, 7}, {tokNumber, "+3", 1, 11},
+            {tokIdent, "m1M", 1, 14},
+        }},
+        {"CM_ \"a \\\"quoted\\\" \\\\ word\nsecond line\" ;", []token{
+            {tokIdent, "CM_", 1, 1}, {tokString, "a \"quoted\" \\ word\nsecond line", 1, 5},
+            {tokPunct, ";", 2, 14},
+        }},
+        {"\"\"", []token{{tokString, "", 1, 1}}},
+    }
+    for _, tt := range tests {
+        got, err := tokenize(nil, tt.src)
+        if err != nil {
+            t.Errorf("%q: %v", tt.src, err)
+            continue
+        }
+        if !reflect.DeepEqual(got, tt.want) {
+            t.Errorf("%q:\n got %v\nwant %v", tt.src, got, tt.want)
+        }
+    }
+
+    for _, bad := range []string{`CM_ "open`, `BO_ 1 Msg# : 8`} {
+        if _, err := tokenize(nil, bad); err == nil {
+            t.Errorf("%q: no error", bad)
+        }
+    }
+}
+
+func TestOpenAfter(t *testing.T) {
+    for s, want := range map[string]bool{
+        `CM_ "done";`:            false,
+        `CM_ "open`:              true,
+        `CM_ "escaped \" quote`:  true,
+        `CM_ "escaped \\";`:      false,
+        `BO_ 1 Msg: 8 ECU1`:      false,
+    } {
+        if got := openAfter(s, false); got != want {
+            t.Errorf("openAfter(%q, false) = %v, want %v", s, got, want)
+        }
+    }
+
+    // one statement line by line, as Parse checks it
+    open := false
+    for _, tt := range []struct {
+        line string
+        want bool
+    }{
+        {`CM_ "first`, true},
+        {`second \" still open`, true},
+        {`third \\`, true},
+        {`last";`, false},
+    } {
+        if open = openAfter(tt.line, open); open != tt.want {
+            t.Errorf("after %q: open = %v, want %v", tt.line, open, tt.want)
+        }
+    }
+}
@@ -0,0 +1,32 @@
+package dbc
+
+// MessageByID returns the message with the given BO_ ID, or nil. The ID is
+// the raw file form, i.e. with bit 31 set for extended frames (see RawID).
+func (f *DBCFile) MessageByID(id uint32) *Message {
+    for i := range f.Messages {
+        if f.Messages[i].RawID() == id {
+            return &f.Messages[i]
+        }
+    }
+    return nil
+}
+
+// SignalByName returns the signal of m called name, or nil
+func (m *Message) SignalByName(name string) *Signal {
+    for i := range m.Signals {
+        if m.Signals[i].Name == name {
+            return &m.Signals[i]
+        }
+    }
+    return nil
+}
+
+// EnvVarByName returns the EV_ environment variable called name, or nil
+func (f *DBCFile) EnvVarByName(name string) *EnvironmentVariable {
+    for i := range f.EnvVars {
+        if f.EnvVars[i].Name == name {
+            return &f.EnvVars[i]
+        }
+    }
+    return nil
+}
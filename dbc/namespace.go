@@ -0,0 +1,58 @@
+package dbc
+
+// standardSymbols is the NS_ block CANdb++ writes, in its order
+var standardSymbols = []string{
+    "NS_DESC_", "CM_", "BA_DEF_", "BA_", "VAL_", "CAT_DEF_", "CAT_", "FILTER",
+    "BA_DEF_DEF_", "EV_DATA_", "ENVVAR_DATA_", "SGTYPE_", "SGTYPE_VAL_",
+    "BA_DEF_SGTYPE_", "BA_SGTYPE_", "SIG_TYPE_REF_", "VAL_TABLE_", "SIG_GROUP_",
+    "SIG_VALTYPE_", "SIGTYPE_VALTYPE_", "BO_TX_BU_", "BA_DEF_REL_", "BA_REL_",
+    "BA_DEF_DEF_REL_", "BU_SG_REL_", "BU_EV_REL_", "BU_BO_REL_", "SG_MUL_VAL_",
+}
+
+// UsedSymbols returns the optional keywords the model will be saved with,
+// in standard NS_ order
+func (f *DBCFile) UsedSymbols() []string {
+    defs, values := f.frameFormatAttributes()
+    used := map[string]bool{
+        "CM_":        len(f.Comments) > 0,
+        "BA_DEF_":    len(defs) > 0,
+        "BA_":        len(values) > 0,
+        "VAL_TABLE_": len(f.ValueTables) > 0,
+    }
+    for _, def := range defs {
+        used["BA_DEF_DEF_"] = used["BA_DEF_DEF_"] || def.DefaultValue != ""
+    }
+    for _, ev := range f.EnvVars {
+        used["VAL_"] = used["VAL_"] || len(ev.ValueDescriptions) > 0
+        used["ENVVAR_DATA_"] = used["ENVVAR_DATA_"] || ev.Type == EnvData
+    }
+    for _, m := range f.Messages {
+        used["BO_TX_BU_"] = used["BO_TX_BU_"] || len(m.Transmitters) > 1
+        used["SIG_GROUP_"] = used["SIG_GROUP_"] || len(m.SignalGroups) > 0
+        for _, s := range m.Signals {
+            used["VAL_"] = used["VAL_"] || len(s.ValueDescriptions) > 0
+            used["SIG_VALTYPE_"] = used["SIG_VALTYPE_"] || s.ValueType != ValueInteger
+            used["SG_MUL_VAL_"] = used["SG_MUL_VAL_"] || len(s.MuxRanges) > 0
+        }
+    }
+
+    var symbols []string
+    for _, s := range standardSymbols {
+        if used[s] {
+            symbols = append(symbols, s)
+        }
+    }
+    return symbols
+}
+
+// namespaceSymbols returns the NS_ list to write: the symbols declared in
+// the original file, followed by any used keywords they were missing
+func (f *DBCFile) namespaceSymbols() []string {
+    symbols := append([]string(nil), f.NewSymbols...)
+    for _, s := range f.UsedSymbols() {
+        if !contains(symbols, s) {
+            symbols = append(symbols, s)
+        }
+    }
+    return symbols
+}
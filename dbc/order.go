@@ -0,0 +1,141 @@
+package dbc
+
+import (
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// SaveOrder selects how Save orders messages, signals and the statements
+// that refer to them
+type SaveOrder int
+
+const (
+    // OrderOriginal keeps the order of the model (for parsed files, the
+    // order of the source file)
+    OrderOriginal SaveOrder = iota
+    // OrderByID sorts messages by ID and signals by start bit
+    OrderByID
+    // OrderByName sorts messages and signals by name
+    OrderByName
+)
+
+// objectRank orders CM_ and BA_ statements by the kind of object they
+// refer to, network first
+var objectRank = map[string]int{"": 0, "CM_": 0, "BU_": 1, "BO_": 2, "SG_": 3, "EV_": 4}
+
+// sorted returns a copy of f ordered by the given policy. The copy shares
+// everything it does not reorder with f, so it must not be modified.
+func (f *DBCFile) sorted(order SaveOrder) *DBCFile {
+    if order == OrderOriginal {
+        return f
+    }
+    out := *f
+
+    out.Messages = make([]Message, len(f.Messages))
+    for i, m := range f.Messages {
+        m.Signals = append([]Signal(nil), m.Signals...)
+        m.SignalGroups = append([]SignalGroup(nil), m.SignalGroups...)
+        sort.SliceStable(m.Signals, func(a, b int) bool {
+            sa, sb := m.Signals[a], m.Signals[b]
+            if order == OrderByID && sa.StartBit != sb.StartBit {
+                return sa.StartBit < sb.StartBit
+            }
+            return sa.Name < sb.Name
+        })
+        sort.SliceStable(m.SignalGroups, func(a, b int) bool {
+            return m.SignalGroups[a].Name < m.SignalGroups[b].Name
+        })
+        out.Messages[i] = m
+    }
+    sort.SliceStable(out.Messages, func(a, b int) bool {
+        ma, mb := out.Messages[a], out.Messages[b]
+        if order == OrderByName && ma.Name != mb.Name {
+            return ma.Name < mb.Name
+        }
+        return ma.RawID() < mb.RawID()
+    })
+
+    out.ValueTables = append([]ValueTable(nil), f.ValueTables...)
+    sort.SliceStable(out.ValueTables, func(a, b int) bool {
+        return out.ValueTables[a].Name < out.ValueTables[b].Name
+    })
+    out.EnvVars = append([]EnvironmentVariable(nil), f.EnvVars...)
+    sort.SliceStable(out.EnvVars, func(a, b int) bool {
+        return out.EnvVars[a].Name < out.EnvVars[b].Name
+    })
+
+    // fold in the frame format attributes first so they are sorted too
+    out.Attributes, out.AttrValues = f.frameFormatAttributes()
+    sort.SliceStable(out.Attributes, func(a, b int) bool {
+        return out.Attributes[a].Name < out.Attributes[b].Name
+    })
+    sort.SliceStable(out.AttrValues, func(a, b int) bool {
+        va, vb := out.AttrValues[a], out.AttrValues[b]
+        if c := f.compareObjects(order, va.ObjectType, va.ObjectName, vb.ObjectType, vb.ObjectName); c != 0 {
+            return c < 0
+        }
+        return va.AttrName < vb.AttrName
+    })
+    out.Comments = append([]Comment(nil), f.Comments...)
+    sort.SliceStable(out.Comments, func(a, b int) bool {
+        ca, cb := out.Comments[a], out.Comments[b]
+        return f.compareObjects(order, ca.ObjectType, ca.ObjectName, cb.ObjectType, cb.ObjectName) < 0
+    })
+    return &out
+}
+
+// compareObjects orders two CM_/BA_ object references: by object kind,
+// then by message ID or name as the policy asks, then by name
+func (f *DBCFile) compareObjects(order SaveOrder, typeA, nameA, typeB, nameB string) int {
+    if ra, rb := objectRank[typeA], objectRank[typeB]; ra != rb {
+        return ra - rb
+    }
+    if typeA == "BO_" || typeA == "SG_" {
+        idA, sigA, _ := strings.Cut(nameA, " ")
+        idB, sigB, _ := strings.Cut(nameB, " ")
+        if c := f.compareMessages(order, idA, idB); c != 0 {
+            return c
+        }
+        return f.compareSignals(order, idA, sigA, sigB)
+    }
+    return strings.Compare(nameA, nameB)
+}
+
+// compareSignals orders two signals of the message with raw ID id the way
+// sorted orders the signals themselves
+func (f *DBCFile) compareSignals(order SaveOrder, id, sigA, sigB string) int {
+    if order == OrderByID {
+        if n, err := strconv.ParseUint(id, 10, 32); err == nil {
+            if m := f.MessageByID(uint32(n)); m != nil {
+                sa, sb := m.SignalByName(sigA), m.SignalByName(sigB)
+                if sa != nil && sb != nil && sa.StartBit != sb.StartBit {
+                    return sa.StartBit - sb.StartBit
+                }
+            }
+        }
+    }
+    return strings.Compare(sigA, sigB)
+}
+
+// compareMessages orders two raw message IDs as written in CM_/BA_
+func (f *DBCFile) compareMessages(order SaveOrder, idA, idB string) int {
+    a, errA := strconv.ParseUint(idA, 10, 32)
+    b, errB := strconv.ParseUint(idB, 10, 32)
+    if errA != nil || errB != nil {
+        return strings.Compare(idA, idB)
+    }
+    if order == OrderByName {
+        ma, mb := f.MessageByID(uint32(a)), f.MessageByID(uint32(b))
+        if ma != nil && mb != nil && ma.Name != mb.Name {
+            return strings.Compare(ma.Name, mb.Name)
+        }
+    }
+    switch {
+    case a < b:
+        return -1
+    case a > b:
+        return 1
+    }
+    return 0
+}
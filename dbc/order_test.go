@@ -0,0 +1,111 @@
+package dbc
+
+import (
+    "bytes"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+const unorderedSample = `BU_: ECU1
+
+VAL_TABLE_ Zeta 3 "c" 1 "a" 2 "b" ;
+VAL_TABLE_ Alpha 1 "x" 0 "y" ;
+
+BO_ 300 Alpha: 8 ECU1
+ SG_ Z : 0|8@1+ (1,0) [0|255] "" ECU1
+ SG_ B : 16|8@1+ (1,0) [0|255] "" ECU1
+ SG_ A : 8|8@1+ (1,0) [0|255] "" ECU1
+
+BO_ 100 Zeta: 8 ECU1
+ SG_ Y : 8|8@1+ (1,0) [0|255] "" ECU1
+ SG_ X : 0|8@1+ (1,0) [0|255] "" ECU1
+
+BO_ 200 Mid: 8 ECU1
+ SG_ M : 0|8@1+ (1,0) [0|255] "" ECU1
+
+CM_ SG_ 300 B "b";
+CM_ BO_ 100 "zeta";
+CM_ SG_ 300 Z "z";
+CM_ BO_ 300 "alpha";
+VAL_ 300 Z 9 "nine" 3 "three" 7 "seven" 1 "one" 5 "five" 0 "zero" 2 "two" 8 "eight" ;
+`
+
+// messageLayout lists the BO_ and SG_ names in the order they were written
+func messageLayout(t *testing.T, f *DBCFile, order SaveOrder) []string {
+    t.Helper()
+    var buf bytes.Buffer
+    if _, err := f.WriteWithOptions(&buf, SaveOptions{Order: order}); err != nil {
+        t.Fatal(err)
+    }
+    var names []string
+    for _, line := range strings.Split(buf.String(), "\n") {
+        fields := strings.Fields(line)
+        switch {
+        case len(fields) > 2 && fields[0] == "BO_":
+            names = append(names, strings.TrimSuffix(fields[2], ":"))
+        case len(fields) > 1 && fields[0] == "SG_":
+            names = append(names, fields[1])
+        case len(fields) > 1 && fields[0] == "VAL_TABLE_":
+            names = append(names, "VAL_TABLE_ "+fields[1])
+        case len(fields) > 1 && fields[0] == "CM_":
+            names = append(names, strings.Join(fields[:len(fields)-1], " "))
+        }
+    }
+    return names
+}
+
+func TestSaveOrder(t *testing.T) {
+    f := mustParse(t, unorderedSample)
+    tests := []struct {
+        order SaveOrder
+        want  []string
+    }{
+        {OrderOriginal, []string{
+            "VAL_TABLE_ Zeta", "VAL_TABLE_ Alpha",
+            "Alpha", "Z", "B", "A", "Zeta", "Y", "X", "Mid", "M",
+            "CM_ SG_ 300 B", "CM_ BO_ 100", "CM_ SG_ 300 Z", "CM_ BO_ 300",
+        }},
+        {OrderByID, []string{
+            "VAL_TABLE_ Alpha", "VAL_TABLE_ Zeta",
+            "Zeta", "X", "Y", "Mid", "M", "Alpha", "Z", "A", "B",
+            "CM_ BO_ 100", "CM_ BO_ 300", "CM_ SG_ 300 Z", "CM_ SG_ 300 B",
+        }},
+        {OrderByName, []string{
+            "VAL_TABLE_ Alpha", "VAL_TABLE_ Zeta",
+            "Alpha", "A", "B", "Z", "Mid", "M", "Zeta", "X", "Y",
+            "CM_ BO_ 300", "CM_ BO_ 100", "CM_ SG_ 300 B", "CM_ SG_ 300 Z",
+        }},
+    }
+    for _, tt := range tests {
+        if got := messageLayout(t, f, tt.order); !reflect.DeepEqual(got, tt.want) {
+            t.Errorf("order %d:\n got %q\nwant %q", tt.order, got, tt.want)
+        }
+    }
+}
+
+func TestSaveDeterministic(t *testing.T) {
+    f := mustParse(t, unorderedSample)
+    for _, order := range []SaveOrder{OrderOriginal, OrderByID, OrderByName} {
+        var first bytes.Buffer
+        if _, err := f.WriteWithOptions(&first, SaveOptions{Order: order}); err != nil {
+            t.Fatal(err)
+        }
+        // map iteration order varies between runs; a few tries expose it
+        for i := 0; i < 20; i++ {
+            var again bytes.Buffer
+            if _, err := f.WriteWithOptions(&again, SaveOptions{Order: order}); err != nil {
+                t.Fatal(err)
+            }
+            if !bytes.Equal(first.Bytes(), again.Bytes()) {
+                t.Fatalf("order %d: save %d differs:\n%s\n---\n%s", order, i+2, first.String(), again.String())
+            }
+        }
+        if !strings.Contains(first.String(), `VAL_ 300 Z 0 "zero" 1 "one" 2 "two" 3 "three" 5 "five" 7 "seven" 8 "eight" 9 "nine" ;`) {
+            t.Errorf("order %d: value descriptions not sorted:\n%s", order, first.String())
+        }
+        if !strings.Contains(first.String(), `VAL_TABLE_ Zeta 1 "a" 2 "b" 3 "c";`) {
+            t.Errorf("order %d: value table not sorted:\n%s", order, first.String())
+        }
+    }
+}
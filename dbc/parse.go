@@ -4,6 +4,7 @@ import (
     "bufio"
     "fmt"
     "io"
+    "math"
     "regexp"
     "strconv"
     "strings"
@@ -13,40 +14,203 @@ import (
 type Parser struct {
     file      *DBCFile
     lineNo    int
-    rawBuffer []string
+    stmtLine  int // line on which the statement being dispatched starts
+    lastKey   string // keyword of the last statement that was not kept raw
+    rawOpen   bool   // last raw section is still waiting for its ";"
 		inNamespace bool
+    opts        ParseOptions
+    orphanSignals bool // the last BO_ was skipped, so are its SG_ lines
+    messageIndex  map[uint32]int // raw ID -> index in file.Messages, first one wins
+    ts            tokenStream    // reused for every statement to save allocations
+    signals       []Signal       // SG_ of the last BO_, moved to it by flushSignals
+    names         []string       // block nameList carves receiver lists from
+
+    // strict mode bookkeeping
+    deviations []error          // deviations found in the statement just dispatched
+    seen       map[string]bool  // keywords seen so far
+    rank       int              // statementRank of the furthest statement so far
+    rankKey    string           // and its keyword
+
+    // the raw text of the first and last line of the current statement,
+    // for positions
+    firstLine, lastLine string
+
+    // source bookkeeping for SaveOptions.PreserveFormatting: the lines
+    // with ParseOptions.KeepSource, the spans only when a preserving save
+    // parses them again
+    source      sourceText
+    recordSpans bool
+    spanKey     string // statementKey of the statement just dispatched
+    extendSpan  bool   // the statement just dispatched continues the previous one
 }
 
 // NewParser instantiates a parser for one DBCFile
 func NewParser() *Parser {
+    return NewParserWithOptions(ParseOptions{})
+}
+
+// NewParserWithOptions instantiates a parser for one DBCFile
+func NewParserWithOptions(opts ParseOptions) *Parser {
     return &Parser{
-        file: &DBCFile{},
+        file:         &DBCFile{FileName: opts.FileName},
+        opts:         opts,
+        messageIndex: map[uint32]int{},
+        seen:         map[string]bool{},
+    }
+}
+
+// tokenStream lexes a statement into the parser's reusable token stream.
+// The stream is only valid until the next statement is lexed.
+func (p *Parser) tokenStream(line string) (*tokenStream, error) {
+    toks, err := tokenize(p.ts.toks[:0], line)
+    if err != nil {
+        return nil, err
     }
+    p.ts = tokenStream{toks: toks}
+    return &p.ts, nil
 }
 
-// Parse reads all lines from r and returns a populated DBCFile
+// Parse reads all statements from r and returns a populated DBCFile.
+// A statement is normally one line, but a quoted string that is still open
+// at the end of a line (e.g. a paragraph CM_ comment) continues the
+// statement on the following lines until the string is closed.
+//
+// The input is converted to UTF-8 from ParseOptions.Encoding, or from the
+// encoding detected by looking at the start of r. Detected UTF-8 switches
+// to Windows-1252 at the first invalid byte sequence further on. Text that
+// was read as Windows-1252 but looks like Shift-JIS gets a CodeEncoding
+// warning.
+//
+// By default Parse stops at the first malformed statement. In lenient mode
+// it skips it, records a Diagnostic and only fails on read errors.
 func (p *Parser) Parse(r io.Reader) (*DBCFile, error) {
+    r, enc, diags, err := decodeInput(r, p.opts.Encoding)
+    if err != nil {
+        return nil, err
+    }
+    p.file.Encoding = enc
+    p.file.Diagnostics = append(p.file.Diagnostics, diags...)
+
     scanner := bufio.NewScanner(r)
+    scanner.Split(scanRawLines)
+    // no line length limit: VAL_ and BA_ lines can be megabytes long
+    scanner.Buffer(make([]byte, 0, 64*1024), math.MaxInt)
+    var pending strings.Builder
+    open := false // a string in pending is still open
     for scanner.Scan() {
         p.lineNo++
-        line := strings.TrimSpace(scanner.Text())
-        if line == "" {
-            continue
+        text := scanner.Text()
+        if strings.HasSuffix(text, "\r") {
+            text = strings.TrimSuffix(text, "\r")
+            p.source.crlf = true
         }
-        if err := p.dispatch(line); err != nil {
-            return nil, fmt.Errorf("line %d: %w", p.lineNo, err)
+        if p.opts.KeepSource {
+            p.source.lines = append(p.source.lines, text)
+        }
+        p.lastLine = text
+
+        if pending.Len() > 0 {
+            pending.WriteByte('\n')
+            pending.WriteString(text)
+            if open = openAfter(text, open); open {
+                continue
+            }
+            text = pending.String()
+            pending.Reset()
+        } else {
+            text = strings.TrimSpace(text)
+            if text == "" {
+                continue
+            }
+            p.stmtLine = p.lineNo
+            p.firstLine = p.lastLine
+            if open = openAfter(text, false); open {
+                pending.WriteString(text)
+                continue
+            }
+        }
+
+        p.spanKey, p.extendSpan = "", false
+        if err := p.dispatch(strings.TrimSpace(text)); err != nil {
+            if err := p.report(err); err != nil {
+                return nil, err
+            }
+        }
+        if p.recordSpans {
+            p.recordSpan()
+        }
+        if err := p.reportDeviations(); err != nil {
+            return nil, err
         }
     }
     if err := scanner.Err(); err != nil {
         return nil, err
     }
+    if fb, ok := r.(*utf8Fallback); ok {
+        p.file.Encoding = fb.encoding()
+    }
+    if pending.Len() > 0 {
+        err := &codedError{CodeUnterminatedString, fmt.Errorf("unterminated string")}
+        if err := p.report(err); err != nil {
+            return nil, err
+        }
+    }
+    p.flushSignals()
+    p.checkEnd()
+    if err := p.reportDeviations(); err != nil {
+        return nil, err
+    }
+    p.file.applyFrameFormats()
+    if p.opts.KeepSource {
+        src := p.source
+        src.opts = p.opts
+        p.file.source = &src
+    }
     return p.file, nil
 }
 
-var (
-    // matches e.g. "NS_:" or "NS_  :" capturing "NS_" and ":"
-    keywordRe = regexp.MustCompile(`^([A-Z0-9_]+)\s*(:)?`)
-)
+// report records err as a Diagnostic of the current statement in lenient
+// mode, and otherwise returns it for Parse to fail with
+func (p *Parser) report(err error) error {
+    if !p.opts.Lenient {
+        return fmt.Errorf("line %d: %w", p.stmtLine, err)
+    }
+    p.file.Diagnostics = append(p.file.Diagnostics, p.diagnose(err))
+    return nil
+}
+
+// reportDeviations reports what the strict checks found in the current
+// statement
+func (p *Parser) reportDeviations() error {
+    for _, dev := range p.deviations {
+        if err := p.report(dev); err != nil {
+            return err
+        }
+    }
+    p.deviations = p.deviations[:0]
+    return nil
+}
+
+// colonRequired are the keywords that must be followed by ":"
+var colonRequired = map[string]bool{
+    "NS_": true,
+    "BS_": true,
+    "BU_": true,
+}
+
+// leadingKeyword splits e.g. "NS_ :" into "NS_" and whether a colon
+// follows. key is "" if s does not start with a keyword.
+func leadingKeyword(s string) (key string, hasColon bool) {
+    i := 0
+    for i < len(s) && (s[i] >= 'A' && s[i] <= 'Z' || isDigit(s[i]) || s[i] == '_') {
+        i++
+    }
+    key = s[:i]
+    for i < len(s) && isSpace(s[i]) {
+        i++
+    }
+    return key, key != "" && i < len(s) && s[i] == ':'
+}
 
 // dispatch looks at the line’s leading keyword and routes it.
 // It will error if a keyword that requires “:” is missing its colon.
@@ -57,23 +221,38 @@ func (p *Parser) dispatch(line string) error {
         return nil
     }
 
-    // extract keyword and optional colon
-    m := keywordRe.FindStringSubmatch(trimmed)
-    if len(m) < 2 {
+    // extract keyword and optional colon, e.g. “NS_” or “BO_”
+    key, hasColon := leadingKeyword(trimmed)
+    if key != "SG_" {
+        p.flushSignals()
+    }
+    if key == "" {
         // no keyword at all—treat as raw
-        return p.collectRaw(line)
+        if !p.rawOpen {
+            p.deviatef(token{}, "statement does not start with a keyword")
+        }
+        return p.collectRaw("", line)
     }
-    key := m[1]        // e.g. “NS_” or “BO_”
-    hasColon := m[2] == ":"
 
-    // some keywords require the colon form (NS_, BU_, etc.)
-    colonRequired := map[string]bool{
-        "NS_": true,
-        "BS_": true,
-        "BU_": true,
+    if p.inNamespace {
+        // the NS_ block lists one symbol per line; anything else ends it
+        if !hasColon && len(strings.Fields(trimmed)) == 1 && key == trimmed {
+            p.checkNamespaceSymbol(key)
+            p.file.NewSymbols = append(p.file.NewSymbols, key)
+            p.extendSpan = true
+            return nil
+        }
+        p.inNamespace = false
     }
+
+    // some keywords require the colon form (NS_, BU_, etc.)
     if colonRequired[key] && !hasColon {
-        return fmt.Errorf("line %d: keyword %q missing required colon", p.lineNo, key)
+        p.deviatef(token{}, "keyword %q missing required colon", key)
+        hasColon = true
+    }
+    // an unknown keyword may just continue an unterminated raw statement
+    if _, known := statementRank[key]; known || !p.rawOpen {
+        p.checkStatement(key, trimmed)
     }
 
     // normalize to e.g. “NS_:”
@@ -82,61 +261,92 @@ func (p *Parser) dispatch(line string) error {
         normalized += ":"
     }
 
-    if p.inNamespace {
-        if normalized == "BS_:" {
-            return p.parseHeaderKeyword(normalized, line)
-        } else {
-            return nil // should be parsing and adding information to namespace in parse struct
-        }
-    }
-
     // dispatch
+    var err error
     switch normalized {
     case "NS_:", "BS_:", "BU_:":
-        return p.parseHeaderKeyword(normalized, line)
-    case "BU_": // note: this is catch-all for BU_ without colon? probably unused
-        return p.parseNodeList(line)
+        err = p.parseHeaderKeyword(normalized, line)
     case "CM_":
-        return p.parseComment(line)
+        err = p.parseComment(line)
     case "BA_DEF_":
-        return p.parseAttributeDef(line)
+        err = p.parseAttributeDef(line)
+    case "BA_DEF_DEF_":
+        err = p.parseAttributeDefault(line)
     case "BA_":
-        return p.parseAttributeValue(line)
+        err = p.parseAttributeValue(line)
     case "VAL_TABLE_":
-        return p.parseValueTable(line)
+        err = p.parseValueTable(line)
+    case "VAL_":
+        err = p.parseValueDescriptions(line)
     case "BO_":
-        return p.parseMessage(line)
+        err = p.parseMessage(line)
+        p.orphanSignals = err != nil
+    case "BO_TX_BU_":
+        err = p.parseMessageTransmitters(line)
+    case "SG_MUL_VAL_":
+        err = p.parseExtendedMux(line)
+    case "SIG_VALTYPE_":
+        err = p.parseSignalValueType(line)
+    case "SIG_GROUP_":
+        err = p.parseSignalGroup(line)
+    case "EV_":
+        err = p.parseEnvVar(line)
+    case "ENVVAR_DATA_":
+        err = p.parseEnvVarData(line)
     case "SG_":
-        return p.parseSignal(line)
+        if p.orphanSignals {
+            err = &codedError{CodeOrphanSignal, fmt.Errorf("SG_ skipped with its BO_")}
+            break
+        }
+        err = p.parseSignal(line)
     case "CM_BO_":
-        return p.parseMessageComment(line)
+        err = p.parseMessageComment(line)
     case "VERSION":
-        return p.parseVersion(line)
+        err = p.parseVersion(line)
     default:
-        return p.collectRaw(line)
+        return p.collectRaw(key, line)
     }
+    p.lastKey = key
+    p.rawOpen = false
+    if err == nil && p.recordSpans {
+        // skipped statements keep their text as-is on a preserving save
+        p.spanKey = p.statementKey(key, line)
+    }
+    return err
 }
 
-// collectRaw appends the line to the rawBuffer and
-// flushes it as a RawSection when it ends in “;”
-func (p *Parser) collectRaw(line string) error {
-    p.rawBuffer = append(p.rawBuffer, line)
-    if strings.HasSuffix(line, ";") {
+// collectRaw keeps a statement we do not model as a RawSection, remembering
+// which parsed statement it followed so Save can put it back in place.
+// Lines are joined into one section until one ends in “;”.
+func (p *Parser) collectRaw(key, line string) error {
+    if p.rawOpen {
+        last := &p.file.RawSections[len(p.file.RawSections)-1]
+        last.Lines = append(last.Lines, line)
+        last.Source.EndLine, last.Source.EndColumn = p.span().EndLine, p.span().EndColumn
+        p.extendSpan = true
+    } else {
+        p.spanKey = rawKey(len(p.file.RawSections))
         p.file.RawSections = append(p.file.RawSections, RawSection{
-            Lines: p.rawBuffer,
+            Keyword: key,
+            After:   p.lastKey,
+            Lines:   []string{line},
+            Source:  p.span(),
         })
-        p.rawBuffer = nil
     }
+    p.rawOpen = !strings.HasSuffix(line, ";")
     return nil
 }
 
 // parseNamespace handles the start of the NS_:
-// section. We enter "namespace mode" until we hit BS_:
+// section. We enter "namespace mode" and collect the
+// symbols that follow until the next statement (normally BS_:)
 func (p *Parser) parseNamespace(line string) error {
-    // We're at the start of a namespace block.
-    // Future lines (sub-keywords) are ignored at this
-    // level until we hit BS_:
-    _ = line
+    // symbols may also follow on the NS_ line itself
+    rest := strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(line, "NS_")), ":")
+    for _, sym := range strings.Fields(rest) {
+        p.checkNamespaceSymbol(sym)
+        p.file.NewSymbols = append(p.file.NewSymbols, sym)
+    }
     p.inNamespace = true
     return nil
 }
@@ -148,6 +358,7 @@ func (p *Parser) parseBitTiming(line string) error {
         // Exiting namespace section
         p.inNamespace = false
     }
+    p.file.BitTimingSource = p.span()
 
     // Trim off the "BS_:" prefix
     // line looks like: "BS_: 500000;" or "BS_: 500000"
@@ -182,100 +393,420 @@ func (p *Parser) parseHeaderKeyword(keyword, line string) error {
     return nil
 }
 
-// parseNodeList handles "BU_: NODE1 NODE2 …"
+// parseNodeList handles "BU_: NODE1 NODE2 …", also with a space before
+// the colon
 func (p *Parser) parseNodeList(line string) error {
-    tokens := strings.Fields(line)
-    // tokens[0] == "BU_:"
-    for _, node := range tokens[1:] {
-        p.file.Nodes = append(p.file.Nodes, Node{Name: node})
+    ts, err := p.tokenStream(line)
+    if err != nil {
+        return err
+    }
+    ts.next() // BU_
+    ts.accept(":")
+    for !ts.atEnd() {
+        node, err := ts.expect(tokIdent, "node name")
+        if err != nil {
+            return fmt.Errorf("invalid BU_ line: %w", err)
+        }
+        // each node gets the span of its own name
+        src := p.span()
+        src.Column += int(node.col) - 1
+        src.EndColumn = src.Column + len(node.text) - 1
+        p.file.Nodes = append(p.file.Nodes, Node{Name: node.text, Source: src})
     }
     return nil
 }
 
 // parseValueTable handles "VAL_TABLE_ TableName val "str" val "str" …;"
 func (p *Parser) parseValueTable(line string) error {
-    // regex: VAL_TABLE_ (\w+) ([0-9]+) "([^"]+)" … ;
-    re := regexp.MustCompile(`VAL_TABLE_\s+(\w+)\s+(.*);`)
-    matches := re.FindStringSubmatch(line)
-    if len(matches) != 3 {
-        return fmt.Errorf("invalid VAL_TABLE_ syntax")
-    }
-    name := matches[1]
-    rest := matches[2]
-    parts := strings.Fields(rest)
-    values := make(map[int]string)
-    for i := 0; i < len(parts); i += 2 {
-        key, err := strconv.Atoi(parts[i])
-        if err != nil {
-            return err
-        }
-        str := strings.Trim(parts[i+1], `"`)
-        values[key] = str
+    ts, err := p.tokenStream(line)
+    if err != nil {
+        return err
+    }
+    ts.next() // VAL_TABLE_
+    name, err := ts.expect(tokIdent, "value table name")
+    if err != nil {
+        return fmt.Errorf("invalid VAL_TABLE_ syntax: %w", err)
+    }
+    values, err := parseValuePairs(ts)
+    if err != nil {
+        return fmt.Errorf("VAL_TABLE_ %s: %w", name.text, err)
     }
     p.file.ValueTables = append(p.file.ValueTables, ValueTable{
-        Name:   name,
+        Name:   name.text,
         Values: values,
+        Source: p.span(),
     })
     return nil
 }
 
-// parseAttributeDef handles "BA_DEF_ BO_  MSG_TX_Attr INT 0 1;"
-// simplified example
+// parseValueDescriptions handles "VAL_ 100 GearPos 0 "Park" 1 "Reverse" ;"
+// and the environment variable form "VAL_ EnvName 0 "Off" 1 "On" ;"
+func (p *Parser) parseValueDescriptions(line string) error {
+    ts, err := p.tokenStream(line)
+    if err != nil {
+        return err
+    }
+    ts.next() // VAL_
+    if ts.peek().kind == tokIdent {
+        name := ts.next().text
+        ev := p.file.EnvVarByName(name)
+        if ev == nil {
+            return referenceErrorf("VAL_ references unknown environment variable %q", name)
+        }
+        values, err := parseValuePairs(ts)
+        if err != nil {
+            return fmt.Errorf("VAL_ %s: %w", name, err)
+        }
+        ev.ValueDescriptions = values
+        ev.ValueDescriptionsSource = p.span()
+        return nil
+    }
+    if ts.peek().kind != tokNumber {
+        return ts.errorf("invalid VAL_ syntax: expected message ID or environment variable, got %s", ts.peek())
+    }
+    id := ts.next().text
+    sigName, err := ts.expect(tokIdent, "signal name")
+    if err != nil {
+        return fmt.Errorf("invalid VAL_ syntax: %w", err)
+    }
+    msg := p.findMessage(id)
+    if msg == nil {
+        return referenceErrorf("VAL_ references unknown message %s", id)
+    }
+    sig := msg.SignalByName(sigName.text)
+    if sig == nil {
+        return referenceErrorf("VAL_ references unknown signal %q in message %s", sigName.text, id)
+    }
+    values, err := parseValuePairs(ts)
+    if err != nil {
+        return fmt.Errorf("VAL_ %s %s: %w", id, sigName.text, err)
+    }
+    sig.ValueDescriptions = values
+    sig.ValueDescriptionsSource = p.span()
+    return nil
+}
+
+// parseValuePairs reads `<int> "<description>"` pairs up to the closing ";"
+func parseValuePairs(ts *tokenStream) (map[int]string, error) {
+    values := make(map[int]string)
+    for !ts.atEnd() {
+        num, err := ts.expect(tokNumber, "value")
+        if err != nil {
+            return nil, err
+        }
+        key, err := strconv.Atoi(num.text)
+        if err != nil {
+            return nil, fmt.Errorf("invalid value %q: %w", num.text, err)
+        }
+        desc, err := ts.expect(tokString, "quoted description")
+        if err != nil {
+            return nil, err
+        }
+        values[key] = desc.text
+    }
+    return values, nil
+}
+
+var attrDefRe = regexp.MustCompile(`^BA_DEF_\s+` +
+    `(?:(BU_|BO_|SG_|EV_)\s+)?` +                   // 1=optional object type, none for network
+    `"((?:[^"\\]|\\.)*)"\s+` +                     // 2=attribute name
+    `(INT|HEX|FLOAT|STRING|ENUM)` +                  // 3=value type
+    `\s*(.*?)\s*;?\s*$`)                            // 4=type-specific rest (range or enum list)
+
+// parseAttributeDef handles e.g.
+//   BA_DEF_ BO_ "GenMsgCycleTime" INT 0 65535;
+//   BA_DEF_ "BusType" STRING ;
+//   BA_DEF_ SG_ "GenSigSendType" ENUM "Cyclic","OnWrite";
 func (p *Parser) parseAttributeDef(line string) error {
-    // [...] use fmt.Sscanf or regex to extract Name, AppliesTo, Type, etc.
-    // p.file.Attributes = append(p.file.Attributes, def)
+    m := attrDefRe.FindStringSubmatch(line)
+    if m == nil {
+        return fmt.Errorf("invalid BA_DEF_ line: %q", line)
+    }
+    def := AttributeDefinition{
+        Name: unescapeString(m[2]),
+    }
+    if m[1] != "" {
+        def.AppliesTo = []string{m[1]}
+    }
+    rest := m[4]
+
+    switch m[3] {
+    case "INT", "HEX", "FLOAT":
+        def.DataType = map[string]AttributeDataType{
+            "INT":   AttrInt,
+            "HEX":   AttrHex,
+            "FLOAT": AttrFloat,
+        }[m[3]]
+        bounds := strings.Fields(rest)
+        if len(bounds) != 2 {
+            return fmt.Errorf("attribute %q: %s needs a minimum and maximum", def.Name, m[3])
+        }
+        minv, err := strconv.ParseFloat(bounds[0], 64)
+        if err != nil {
+            return fmt.Errorf("attribute %q: invalid minimum %q: %w", def.Name, bounds[0], err)
+        }
+        maxv, err := strconv.ParseFloat(bounds[1], 64)
+        if err != nil {
+            return fmt.Errorf("attribute %q: invalid maximum %q: %w", def.Name, bounds[1], err)
+        }
+        def.Minimum = minv
+        def.Maximum = maxv
+    case "STRING":
+        def.DataType = AttrString
+        if rest != "" {
+            return fmt.Errorf("attribute %q: unexpected %q after STRING", def.Name, rest)
+        }
+    case "ENUM":
+        def.DataType = AttrEnum
+        values, err := p.enumValues(line)
+        if err != nil {
+            return fmt.Errorf("attribute %q: %w", def.Name, err)
+        }
+        def.EnumValues = values
+    }
+
+    // a definition that applies to several object types is written as one
+    // BA_DEF_ per type
+    if prev := p.file.AttributeDef(def.Name); prev != nil && len(def.AppliesTo) == 1 &&
+        len(prev.AppliesTo) > 0 && prev.sameType(&def) && !contains(prev.AppliesTo, def.AppliesTo[0]) {
+        prev.AppliesTo = append(prev.AppliesTo, def.AppliesTo[0])
+        return nil
+    }
+    def.Source = p.span()
+    p.file.Attributes = append(p.file.Attributes, def)
+    return nil
+}
+
+// enumValues lexes the "A","B" list after ENUM in a BA_DEF_ line
+func (p *Parser) enumValues(line string) ([]string, error) {
+    ts, err := p.tokenStream(line)
+    if err != nil {
+        return nil, err
+    }
+    for !ts.accept("ENUM") && ts.peek().kind != tokEOF {
+        ts.next()
+    }
+    var values []string
+    for i := 0; !ts.atEnd(); i++ {
+        if i > 0 && !ts.accept(",") {
+            return nil, ts.errorf("expected \",\" or \";\" in ENUM list, got %s", ts.peek())
+        }
+        v, err := ts.expect(tokString, "quoted ENUM value")
+        if err != nil {
+            return nil, err
+        }
+        values = append(values, v.text)
+    }
+    return values, nil
+}
+
+var attrDefaultRe = regexp.MustCompile(`^BA_DEF_DEF_\s+"((?:[^"\\]|\\.)*)"\s+("(?:[^"\\]|\\.)*"|[^\s;"]+)\s*;?\s*$`)
+
+// parseAttributeDefault handles "BA_DEF_DEF_ "GenMsgCycleTime" 100;"
+// and stores the value on the matching BA_DEF_ definition
+func (p *Parser) parseAttributeDefault(line string) error {
+    m := attrDefaultRe.FindStringSubmatch(line)
+    if m == nil {
+        return fmt.Errorf("invalid BA_DEF_DEF_ line: %q", line)
+    }
+    name := unescapeString(m[1])
+    def := p.file.AttributeDef(name)
+    if def == nil {
+        return referenceErrorf("BA_DEF_DEF_ for undefined attribute %q", name)
+    }
+    def.DefaultValue = unquoteValue(m[2])
+    def.DefaultSource = p.span()
     return nil
 }
 
-// parseAttributeValue handles "BA_ “AttrName” BO_ 123 “42”;"
+// parseAttributeValue handles the BA_ forms:
+//   BA_ "BusType" "CAN";
+//   BA_ "NodeAddress" BU_ ECU1 17;
+//   BA_ "GenMsgCycleTime" BO_ 100 10;
+//   BA_ "GenSigStartValue" SG_ 100 EngineSpeed 800;
+//   BA_ "EnvAttr" EV_ EnvVarName 1;
 func (p *Parser) parseAttributeValue(line string) error {
+    ts, err := p.tokenStream(line)
+    if err != nil {
+        return fmt.Errorf("invalid BA_ line: %w", err)
+    }
+    ts.next() // BA_
+
+    name, err := ts.expect(tokString, "attribute name")
+    if err != nil {
+        return fmt.Errorf("invalid BA_ line: %w", err)
+    }
+    av := AttributeValue{AttrName: name.text}
+
+    // the object, if any, as up to two names after its type
+    var obj [2]token
+    switch t := ts.peek(); {
+    case t.kind != tokIdent:
+        // network-level attribute, no object
+    case t.text == "BU_" || t.text == "EV_":
+        ts.next()
+        av.ObjectType = t.text
+        obj[0], err = ts.expect(tokIdent, "object name")
+    case t.text == "BO_":
+        ts.next()
+        av.ObjectType = "BO_"
+        obj[0], err = ts.expect(tokNumber, "message ID")
+    case t.text == "SG_":
+        ts.next()
+        av.ObjectType = "SG_"
+        if obj[0], err = ts.expect(tokNumber, "message ID"); err == nil {
+            obj[1], err = ts.expect(tokIdent, "signal name")
+        }
+    }
+    if err != nil {
+        return fmt.Errorf("invalid BA_ line: %w", err)
+    }
+
+    value := ts.next()
+    if value.kind != tokString && value.kind != tokNumber && value.kind != tokIdent {
+        return fmt.Errorf("invalid BA_ line: %w", &posError{value.line, value.col, fmt.Errorf("expected value, got %s", value)})
+    }
+    if !ts.atEnd() {
+        return fmt.Errorf("invalid BA_ line: %w", ts.errorf("unexpected %s after value", ts.peek()))
+    }
+    av.Value = value.text
+
+    switch av.ObjectType {
+    case "BU_":
+        if !p.hasNode(obj[0].text) {
+            return referenceErrorf("BA_ %q references unknown node %q", av.AttrName, obj[0].text)
+        }
+        av.ObjectName = obj[0].text
+    case "EV_":
+        if p.file.EnvVarByName(obj[0].text) == nil {
+            return referenceErrorf("BA_ %q references unknown environment variable %q", av.AttrName, obj[0].text)
+        }
+        av.ObjectName = obj[0].text
+    case "BO_":
+        if p.findMessage(obj[0].text) == nil {
+            return referenceErrorf("BA_ %q references unknown message %s", av.AttrName, obj[0].text)
+        }
+        av.ObjectName = obj[0].text
+    case "SG_":
+        msg := p.findMessage(obj[0].text)
+        if msg == nil {
+            return referenceErrorf("BA_ %q references unknown message %s", av.AttrName, obj[0].text)
+        }
+        if msg.SignalByName(obj[1].text) == nil {
+            return referenceErrorf("BA_ %q references unknown signal %q in message %s", av.AttrName, obj[1].text, obj[0].text)
+        }
+        av.ObjectName = obj[0].text + " " + obj[1].text
+    }
+
+    av.Source = p.span()
+    p.file.AttrValues = append(p.file.AttrValues, av)
     return nil
 }
 
-var commentRe = regexp.MustCompile(`^CM_\s*` +
-    `(?:(BO|SG|BU)_\s+([^ "\t]+)` +    // 1=objType (BO/SG/BU), 2=objRef (ID or name)
-      `(?:\s+([A-Za-z0-9_]+))?` +      // 3=optional signal name for SG_
-    `\s+)?` +
-    `"([^"]*)"` +                      // 4=the comment text
-    `\s*;?\s*$`)
-// parseComment handles generic CM_ comments
+// unescapeString undoes the \" and \\ escapes of a DBC string literal
+func unescapeString(s string) string {
+    if !strings.Contains(s, `\`) {
+        return s
+    }
+    var sb strings.Builder
+    for i := 0; i < len(s); i++ {
+        if s[i] == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\') {
+            i++
+        }
+        sb.WriteByte(s[i])
+    }
+    return sb.String()
+}
+
+// unquoteValue returns an attribute value without its quotes, if any
+func unquoteValue(s string) string {
+    if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+        return unescapeString(s[1 : len(s)-1])
+    }
+    return s
+}
+
+// findMessage returns the already-parsed message whose BO_ ID matches id
+func (p *Parser) findMessage(id string) *Message {
+    n, err := strconv.ParseUint(id, 10, 32)
+    if err != nil {
+        return nil
+    }
+    if i, ok := p.messageIndex[uint32(n)]; ok {
+        return &p.file.Messages[i]
+    }
+    return nil
+}
+
+// hasNode reports whether name was declared on the BU_ line
+func (p *Parser) hasNode(name string) bool {
+    for _, n := range p.file.Nodes {
+        if n.Name == name {
+            return true
+        }
+    }
+    return false
+}
+
+// parseComment handles generic CM_ comments:
+//   CM_ "network comment";
+//   CM_ BU_ <node> "text";
+//   CM_ BO_ <id> "text";
+//   CM_ SG_ <id> <signal> "text";
+//   CM_ EV_ <envvar> "text";
 func (p *Parser) parseComment(line string) error {
-    m := commentRe.FindStringSubmatch(line)
-    if m == nil {
-        return fmt.Errorf("invalid CM_ line: %q", line)
-    }
-    objType   := m[1]       // e.g. "BO", "SG", "BU", or "" for file‐level
-    objRef    := m[2]       // ID or name
-    sigName   := m[3]       // only set if objType=="SG"
-    text      := m[4]       // comment
-
-    switch objType {
-    case "BO":
-        p.file.Comments = append(p.file.Comments, Comment{
-            ObjectType: "BO_",
-            ObjectName: objRef,
-            Text:       text,
-        })
-    case "SG":
-        p.file.Comments = append(p.file.Comments, Comment{
-            ObjectType: "SG_",
-            ObjectName: objRef + " " + sigName,
-            Text:       text,
-        })
-    case "BU":
-        p.file.Comments = append(p.file.Comments, Comment{
-            ObjectType: "BU_",
-            ObjectName: objRef,
-            Text:       text,
-        })
-    default:
-        // file‐level comment or unknown
-        p.file.Comments = append(p.file.Comments, Comment{
-            ObjectType: "CM_",
-            ObjectName: "",
-            Text:       text,
-        })
+    ts, err := p.tokenStream(line)
+    if err != nil {
+        return fmt.Errorf("invalid CM_ line: %w", err)
     }
+    ts.next() // CM_
+
+    c := Comment{ObjectType: "CM_"} // file-level unless an object follows
+    t := ts.peek()
+    if t.kind != tokIdent {
+        t.text = "" // a quoted "BO_" is a comment, not an object type
+    }
+    switch t.text {
+    case "BU_", "EV_":
+        ts.next()
+        name, err := ts.expect(tokIdent, "object name")
+        if err != nil {
+            return fmt.Errorf("invalid CM_ line: %w", err)
+        }
+        c.ObjectType = t.text
+        c.ObjectName = name.text
+    case "BO_":
+        ts.next()
+        id, err := ts.expect(tokNumber, "message ID")
+        if err != nil {
+            return fmt.Errorf("invalid CM_ line: %w", err)
+        }
+        c.ObjectType = "BO_"
+        c.ObjectName = id.text
+    case "SG_":
+        ts.next()
+        id, err := ts.expect(tokNumber, "message ID")
+        if err != nil {
+            return fmt.Errorf("invalid CM_ line: %w", err)
+        }
+        name, err := ts.expect(tokIdent, "signal name")
+        if err != nil {
+            return fmt.Errorf("invalid CM_ line: %w", err)
+        }
+        c.ObjectType = "SG_"
+        c.ObjectName = id.text + " " + name.text
+    }
+
+    text, err := ts.expect(tokString, "quoted comment")
+    if err != nil {
+        return fmt.Errorf("invalid CM_ line: %w", err)
+    }
+    if !ts.atEnd() {
+        return ts.errorf("invalid CM_ line: unexpected %s after comment", ts.peek())
+    }
+    c.Text = text.text
+    c.Source = p.span()
+    p.file.Comments = append(p.file.Comments, c)
     return nil
 }
 
@@ -287,132 +818,636 @@ func (p *Parser) parseMessageComment(line string) error {
 
 // parseMessage handles "BO_ 1234 MsgName: 8 Vector__XXX"
 func (p *Parser) parseMessage(line string) error {
-    var (
-        id   uint32
-        name string
-        dlc  int
-        tx   string
-    )
-    // BO_ <ID> <Name>: <DLC> <TxList>
-    fmt.Sscanf(line, "BO_ %d %s: %d %s", &id, &name, &dlc, &tx)
+    ts, err := p.tokenStream(line)
+    if err != nil {
+        return err
+    }
+    ts.next() // BO_
+
+    // BO_ <ID> <Name>: <DLC> <Transmitter>
+    idTok, err := ts.expect(tokNumber, "message ID")
+    if err != nil {
+        return fmt.Errorf("invalid BO_ line: %w", err)
+    }
+    id, err := strconv.ParseUint(idTok.text, 10, 32)
+    if err != nil {
+        return fmt.Errorf("invalid BO_ message ID %q: %w", idTok.text, err)
+    }
+    name, err := ts.expect(tokIdent, "message name")
+    if err != nil {
+        return fmt.Errorf("invalid BO_ line: %w", err)
+    }
+    if !ts.accept(":") {
+        return ts.errorf("invalid BO_ line: expected \":\" after %s, got %s", name.text, ts.peek())
+    }
+    dlcTok, err := ts.expect(tokNumber, "message size")
+    if err != nil {
+        return fmt.Errorf("invalid BO_ line: %w", err)
+    }
+    dlc, err := strconv.Atoi(dlcTok.text)
+    if err != nil {
+        return fmt.Errorf("invalid BO_ message size %q: %w", dlcTok.text, err)
+    }
+
     msg := Message{
-        ID:           id,
-        Name:         name,
+        ID:           uint32(id) &^ extendedIDFlag,
+        IsExtended:   uint32(id)&extendedIDFlag != 0,
+        Name:         name.text,
         DLC:          dlc,
-        Transmitters: strings.Split(tx, ","),
+    }
+    p.checkMessageID(idTok, &msg)
+    if tx := ts.next(); tx.kind == tokIdent {
+        p.checkNode(tx, "transmitter")
+        msg.Transmitters = []string{tx.text}
+    } else if tx.kind == tokEOF {
+        p.deviatef(tx, "BO_ %s has no transmitter; use Vector__XXX", name.text)
+    } else {
+        return fmt.Errorf("invalid BO_ line: expected transmitter, got %s", tx)
+    }
+    if !ts.atEnd() {
+        return ts.errorf("invalid BO_ line: unexpected %s", ts.peek())
+    }
+    msg.Source = p.span()
+    if _, ok := p.messageIndex[msg.RawID()]; !ok {
+        p.messageIndex[msg.RawID()] = len(p.file.Messages)
     }
     p.file.Messages = append(p.file.Messages, msg)
     return nil
 }
 
+// parseMessageTransmitters handles "BO_TX_BU_ 1234 : NodeA,NodeB;" which
+// lists every node that sends the message, in addition to the BO_ sender
+func (p *Parser) parseMessageTransmitters(line string) error {
+    ts, err := p.tokenStream(line)
+    if err != nil {
+        return err
+    }
+    ts.next() // BO_TX_BU_
+
+    id, err := ts.expect(tokNumber, "message ID")
+    if err != nil {
+        return fmt.Errorf("invalid BO_TX_BU_ line: %w", err)
+    }
+    msg := p.findMessage(id.text)
+    if msg == nil {
+        return referenceErrorf("BO_TX_BU_ references unknown message %s", id.text)
+    }
+    if !ts.accept(":") {
+        return ts.errorf("invalid BO_TX_BU_ line: expected \":\", got %s", ts.peek())
+    }
+    msg.TransmittersSource = p.span()
+    for i := 0; !ts.atEnd(); i++ {
+        if i > 0 && !ts.accept(",") {
+            p.deviatef(ts.peek(), "transmitters must be separated by \",\"")
+        }
+        node, err := ts.expect(tokIdent, "transmitter")
+        if err != nil {
+            return fmt.Errorf("invalid BO_TX_BU_ line: %w", err)
+        }
+        p.checkNode(node, "transmitter")
+        if len(msg.Transmitters) == 1 && msg.Transmitters[0] == "Vector__XXX" {
+            // the BO_ sender was only a placeholder
+            msg.Transmitters = msg.Transmitters[:0]
+        }
+        if !contains(msg.Transmitters, node.text) {
+            msg.Transmitters = append(msg.Transmitters, node.text)
+        }
+    }
+    return nil
+}
+
+func contains(list []string, s string) bool {
+    for _, v := range list {
+        if v == s {
+            return true
+        }
+    }
+    return false
+}
+
+// parseExtendedMux handles "SG_MUL_VAL_ 100 Sig Switch 1-1, 3-5;" which
+// says which values of Switch activate Sig (extended multiplexing)
+func (p *Parser) parseExtendedMux(line string) error {
+    ts, err := p.tokenStream(line)
+    if err != nil {
+        return err
+    }
+    ts.next() // SG_MUL_VAL_
+
+    id, err := ts.expect(tokNumber, "message ID")
+    if err != nil {
+        return fmt.Errorf("invalid SG_MUL_VAL_ line: %w", err)
+    }
+    sigName, err := ts.expect(tokIdent, "signal name")
+    if err != nil {
+        return fmt.Errorf("invalid SG_MUL_VAL_ line: %w", err)
+    }
+    switchName, err := ts.expect(tokIdent, "multiplexer switch name")
+    if err != nil {
+        return fmt.Errorf("invalid SG_MUL_VAL_ line: %w", err)
+    }
+
+    msg := p.findMessage(id.text)
+    if msg == nil {
+        return referenceErrorf("SG_MUL_VAL_ references unknown message %s", id.text)
+    }
+    sig := msg.SignalByName(sigName.text)
+    if sig == nil {
+        return referenceErrorf("SG_MUL_VAL_ references unknown signal %q in message %s", sigName.text, id.text)
+    }
+    sw := msg.SignalByName(switchName.text)
+    if sw == nil || (sw.MuxType != MuxSwitch && sw.MuxType != MuxSignalSwitch) {
+        return fmt.Errorf("SG_MUL_VAL_: %q is not a multiplexer switch in message %s", switchName.text, id.text)
+    }
+
+    var ranges []MuxValueRange
+    for !ts.atEnd() {
+        r, err := parseMuxRange(ts)
+        if err != nil {
+            return fmt.Errorf("SG_MUL_VAL_ %s %s: %w", id.text, sigName.text, err)
+        }
+        ranges = append(ranges, r)
+        ts.accept(",")
+    }
+    sig.MuxSwitchName = switchName.text
+    sig.MuxRanges = append(sig.MuxRanges, ranges...)
+    sig.MuxSource = p.span()
+    return nil
+}
+
+// parseMuxRange reads "lo-hi". The lexer turns "-hi" into a negative
+// number, so both "3-5" and "3 - 5" are accepted.
+func parseMuxRange(ts *tokenStream) (MuxValueRange, error) {
+    lo, err := ts.expect(tokNumber, "range start")
+    if err != nil {
+        return MuxValueRange{}, err
+    }
+    ts.accept("-")
+    hi, err := ts.expect(tokNumber, "range end")
+    if err != nil {
+        return MuxValueRange{}, err
+    }
+    minv, err := strconv.Atoi(lo.text)
+    if err != nil {
+        return MuxValueRange{}, fmt.Errorf("invalid range start %q: %w", lo.text, err)
+    }
+    maxv, err := strconv.Atoi(strings.TrimPrefix(hi.text, "-"))
+    if err != nil {
+        return MuxValueRange{}, fmt.Errorf("invalid range end %q: %w", hi.text, err)
+    }
+    return MuxValueRange{Min: minv, Max: maxv}, nil
+}
+
+// parseSignalValueType handles "SIG_VALTYPE_ 100 Sig : 1;" where
+// 1 means IEEE float and 2 IEEE double
+func (p *Parser) parseSignalValueType(line string) error {
+    ts, err := p.tokenStream(line)
+    if err != nil {
+        return err
+    }
+    ts.next() // SIG_VALTYPE_
+
+    id, err := ts.expect(tokNumber, "message ID")
+    if err != nil {
+        return fmt.Errorf("invalid SIG_VALTYPE_ line: %w", err)
+    }
+    sigName, err := ts.expect(tokIdent, "signal name")
+    if err != nil {
+        return fmt.Errorf("invalid SIG_VALTYPE_ line: %w", err)
+    }
+    if !ts.accept(":") {
+        // optional in files written by some tools
+        p.deviatef(ts.peek(), "expected \":\" before the value type")
+    }
+    vt, err := ts.expect(tokNumber, "value type")
+    if err != nil {
+        return fmt.Errorf("invalid SIG_VALTYPE_ line: %w", err)
+    }
+    if !ts.atEnd() {
+        return ts.errorf("invalid SIG_VALTYPE_ line: unexpected %s", ts.peek())
+    }
+
+    msg := p.findMessage(id.text)
+    if msg == nil {
+        return referenceErrorf("SIG_VALTYPE_ references unknown message %s", id.text)
+    }
+    sig := msg.SignalByName(sigName.text)
+    if sig == nil {
+        return referenceErrorf("SIG_VALTYPE_ references unknown signal %q in message %s", sigName.text, id.text)
+    }
+    switch vt.text {
+    case "0":
+        sig.ValueType = ValueInteger
+    case "1":
+        sig.ValueType = ValueFloat
+    case "2":
+        sig.ValueType = ValueDouble
+    default:
+        return fmt.Errorf("SIG_VALTYPE_ %s %s: unknown value type %s", id.text, sigName.text, vt.text)
+    }
+    sig.ValueTypeSource = p.span()
+    return nil
+}
+
+// parseSignalGroup handles "SIG_GROUP_ 100 GroupName 1 : SigA SigB;"
+func (p *Parser) parseSignalGroup(line string) error {
+    ts, err := p.tokenStream(line)
+    if err != nil {
+        return err
+    }
+    ts.next() // SIG_GROUP_
+
+    id, err := ts.expect(tokNumber, "message ID")
+    if err != nil {
+        return fmt.Errorf("invalid SIG_GROUP_ line: %w", err)
+    }
+    name, err := ts.expect(tokIdent, "signal group name")
+    if err != nil {
+        return fmt.Errorf("invalid SIG_GROUP_ line: %w", err)
+    }
+    reps, err := ts.expect(tokNumber, "repetitions")
+    if err != nil {
+        return fmt.Errorf("invalid SIG_GROUP_ line: %w", err)
+    }
+    if !ts.accept(":") {
+        return ts.errorf("invalid SIG_GROUP_ line: expected \":\", got %s", ts.peek())
+    }
+
+    msg := p.findMessage(id.text)
+    if msg == nil {
+        return referenceErrorf("SIG_GROUP_ references unknown message %s", id.text)
+    }
+    group := SignalGroup{Name: name.text}
+    if group.Repetitions, err = strconv.Atoi(reps.text); err != nil {
+        return fmt.Errorf("invalid SIG_GROUP_ repetitions %q: %w", reps.text, err)
+    }
+    for !ts.atEnd() {
+        sig, err := ts.expect(tokIdent, "signal name")
+        if err != nil {
+            return fmt.Errorf("invalid SIG_GROUP_ line: %w", err)
+        }
+        if msg.SignalByName(sig.text) == nil {
+            return referenceErrorf("SIG_GROUP_ %s references unknown signal %q in message %s", group.Name, sig.text, id.text)
+        }
+        group.Signals = append(group.Signals, sig.text)
+        ts.accept(",")
+    }
+    group.Source = p.span()
+    msg.SignalGroups = append(msg.SignalGroups, group)
+    return nil
+}
+
+// parseEnvVar handles
+//   EV_ Name: 0 [0|100] "unit" 0 1 DUMMY_NODE_VECTOR0 Node1,Node2;
+// i.e. name, type (0=int, 1=float, 2=string), range, unit, initial value,
+// ID, access type and the nodes that may access it
+func (p *Parser) parseEnvVar(line string) error {
+    ts, err := p.tokenStream(line)
+    if err != nil {
+        return err
+    }
+    ts.next() // EV_
 
-var versionRe = regexp.MustCompile(`^VERSION\s+"([^"]*)"\s*;?\s*$`)
+    name, err := ts.expect(tokIdent, "environment variable name")
+    if err != nil {
+        return fmt.Errorf("invalid EV_ line: %w", err)
+    }
+    ev := EnvironmentVariable{Name: name.text}
+    if !ts.accept(":") {
+        return ts.errorf("invalid EV_ line: expected \":\" after %s, got %s", name.text, ts.peek())
+    }
+
+    typ, err := ts.expect(tokNumber, "variable type")
+    if err != nil {
+        return fmt.Errorf("invalid EV_ line: %w", err)
+    }
+    switch typ.text {
+    case "0":
+        ev.Type = EnvInteger
+    case "1":
+        ev.Type = EnvFloat
+    case "2":
+        ev.Type = EnvString
+    default:
+        return fmt.Errorf("EV_ %s: unknown variable type %s", ev.Name, typ.text)
+    }
+
+    var nums [2]float64
+    for i, what := range []string{"[", "|"} {
+        if !ts.accept(what) {
+            return ts.errorf("invalid EV_ line: expected %q, got %s", what, ts.peek())
+        }
+        if nums[i], err = expectFloat(ts, "range bound"); err != nil {
+            return fmt.Errorf("invalid EV_ line: %w", err)
+        }
+    }
+    if !ts.accept("]") {
+        return ts.errorf("invalid EV_ line: expected \"]\", got %s", ts.peek())
+    }
+    ev.Minimum, ev.Maximum = nums[0], nums[1]
+
+    unit, err := ts.expect(tokString, "unit")
+    if err != nil {
+        return fmt.Errorf("invalid EV_ line: %w", err)
+    }
+    ev.Unit = unit.text
+    if ev.InitialValue, err = expectFloat(ts, "initial value"); err != nil {
+        return fmt.Errorf("invalid EV_ line: %w", err)
+    }
+    idTok, err := ts.expect(tokNumber, "variable ID")
+    if err != nil {
+        return fmt.Errorf("invalid EV_ line: %w", err)
+    }
+    id, err := strconv.ParseUint(idTok.text, 10, 32)
+    if err != nil {
+        return fmt.Errorf("invalid EV_ ID %q: %w", idTok.text, err)
+    }
+    ev.ID = uint32(id)
+
+    access, err := ts.expect(tokIdent, "access type")
+    if err != nil {
+        return fmt.Errorf("invalid EV_ line: %w", err)
+    }
+    code, err := strconv.ParseUint(strings.TrimPrefix(access.text, "DUMMY_NODE_VECTOR"), 16, 16)
+    if err != nil || !strings.HasPrefix(access.text, "DUMMY_NODE_VECTOR") {
+        return fmt.Errorf("EV_ %s: invalid access type %q", ev.Name, access.text)
+    }
+    ev.AccessType = EnvVarAccess(code & 0x3)
+    if code&envDataFlag != 0 {
+        ev.Type = EnvData
+    }
+
+    for !ts.atEnd() {
+        node, err := ts.expect(tokIdent, "access node")
+        if err != nil {
+            return fmt.Errorf("invalid EV_ line: %w", err)
+        }
+        ev.AccessNodes = append(ev.AccessNodes, node.text)
+        ts.accept(",")
+    }
+    ev.Source = p.span()
+    p.file.EnvVars = append(p.file.EnvVars, ev)
+    return nil
+}
+
+// envDataFlag is set in the DUMMY_NODE_VECTOR access code of data variables
+const envDataFlag = 0x8000
+
+// parseEnvVarData handles "ENVVAR_DATA_ Name: 8;" which makes Name a
+// data environment variable of the given size in bytes
+func (p *Parser) parseEnvVarData(line string) error {
+    ts, err := p.tokenStream(line)
+    if err != nil {
+        return err
+    }
+    ts.next() // ENVVAR_DATA_
+
+    name, err := ts.expect(tokIdent, "environment variable name")
+    if err != nil {
+        return fmt.Errorf("invalid ENVVAR_DATA_ line: %w", err)
+    }
+    if !ts.accept(":") {
+        return ts.errorf("invalid ENVVAR_DATA_ line: expected \":\", got %s", ts.peek())
+    }
+    size, err := ts.expect(tokNumber, "data size")
+    if err != nil {
+        return fmt.Errorf("invalid ENVVAR_DATA_ line: %w", err)
+    }
+    ev := p.file.EnvVarByName(name.text)
+    if ev == nil {
+        return referenceErrorf("ENVVAR_DATA_ references unknown environment variable %q", name.text)
+    }
+    if ev.DataSize, err = strconv.Atoi(size.text); err != nil {
+        return fmt.Errorf("invalid ENVVAR_DATA_ size %q: %w", size.text, err)
+    }
+    ev.Type = EnvData
+    ev.DataSizeSource = p.span()
+    return nil
+}
+
+// expectInt consumes an integer token and converts it
+func expectInt(ts *tokenStream, what string) (int, error) {
+    t, err := ts.expect(tokNumber, what)
+    if err != nil {
+        return 0, err
+    }
+    v, err := strconv.Atoi(t.text)
+    if err != nil {
+        return 0, &posError{t.line, t.col, fmt.Errorf("invalid %s %q", what, t.text)}
+    }
+    return v, nil
+}
+
+// parseMuxIndicator reads the multiplexer indicator after a signal name:
+// "M" for a switch, "m1" for a signal selected by switch value 1, "m1M" for
+// both
+func parseMuxIndicator(spec string) (MultiplexerType, int, error) {
+    if spec == "M" {
+        return MuxSwitch, 0, nil
+    }
+    muxType := MuxSignal
+    if len(spec) > 2 && spec[len(spec)-1] == 'M' {
+        muxType = MuxSignalSwitch
+        spec = spec[:len(spec)-1]
+    }
+    value, err := strconv.Atoi(strings.TrimPrefix(spec, "m"))
+    if err != nil || spec[0] != 'm' || value < 0 {
+        return NoMux, 0, fmt.Errorf("invalid multiplexer indicator %q", spec)
+    }
+    return muxType, value, nil
+}
+
+// expectFloat consumes a number token and converts it
+func expectFloat(ts *tokenStream, what string) (float64, error) {
+    t, err := ts.expect(tokNumber, what)
+    if err != nil {
+        return 0, err
+    }
+    if v, ok := smallInt(t.text); ok {
+        return float64(v), nil
+    }
+    v, err := strconv.ParseFloat(t.text, 64)
+    if err != nil {
+        return 0, fmt.Errorf("invalid %s %q: %w", what, t.text, err)
+    }
+    return v, nil
+}
+
+// smallInt parses the plain integers most numbers in a DBC file are,
+// like "0" or "-10", faster than strconv does. It reports false for
+// anything else.
+func smallInt(s string) (int64, bool) {
+    neg := len(s) > 0 && s[0] == '-'
+    if neg {
+        s = s[1:]
+    }
+    if len(s) == 0 || len(s) > 15 {
+        return 0, false
+    }
+    var v int64
+    for i := 0; i < len(s); i++ {
+        if !isDigit(s[i]) {
+            return 0, false
+        }
+        v = v*10 + int64(s[i]-'0')
+    }
+    if neg {
+        if v == 0 {
+            return 0, false // keep "-0" a negative zero
+        }
+        v = -v
+    }
+    return v, true
+}
+
+var versionRe = regexp.MustCompile(`^VERSION\s+"((?:[^"\\]|\\.)*)"\s*;?\s*$`)
 
 func (p *Parser) parseVersion(line string) error {
     v := versionRe.FindStringSubmatch(line)
     if v == nil {
         return fmt.Errorf("invalid VERSION line: %q", line)
     }
-    p.file.Version = v[1]
+    p.file.Version = unescapeString(v[1])
     return nil
 }
 
-var signalRe = regexp.MustCompile(`^SG_\s+` +                   // literal “SG_” + spaces
-    `(\w+)` +                                                   // 1: Signal name
-    `(?:\s+((?:m\d+M?)|(?:M(?:m\d+)?)))?` +                     // 2: Optional mux specifier, e.g. “M” or “m1”
-    `\s*:\s*` +                                                  
-    `(\d+)` +                                                   // 3: Start bit
-    `\|` +
-    `(\d+)` +                                                   // 4: Length
-    `@` +
-    `([01])` +                                                  // 5: Endianness (0=big,1=little)
-    `([+-])` +                                                  // 6: Sign (+ unsigned, - signed)
-    `\s*\(\s*` +
-    `([0-9.eE+-]+)` +                                           // 7: Factor
-    `\s*,\s*` +
-    `([0-9.eE+-]+)` +                                           // 8: Offset
-    `\s*\)\s*` +
-    `\[\s*` +
-    `([0-9.eE+-]+)` +                                           // 9: Minimum
-    `\s*\|\s*` +
-    `([0-9.eE+-]+)` +                                           // 10: Maximum
-    `\s*\]\s*` +
-    `"(.*?)"` +                                                 // 11: Unit (non-greedy)
-    `\s+` +
-    `(.+)$`)                                                    // 12: Receivers list (comma/space-separated)
-
+// parseSignal handles
+//   SG_ EngineSpeed m1 : 0|16@1+ (0.25,0) [0|16383.75] "rpm" ECU2,Gateway
+// and adds the signal to the last BO_
 func (p *Parser) parseSignal(line string) error {
-    m := signalRe.FindStringSubmatch(line)
-    if m == nil {
-        return fmt.Errorf("invalid SG_ line: %q", line)
-    }
-
-    // m[1] = name
-    // m[2] = mux specifier ("" if none)
-    // m[3] = start bit
-    // m[4] = length
-    // m[5] = endianness
-    // m[6] = sign
-    // m[7] = factor
-    // m[8] = offset
-    // m[9] = min
-    // m[10]= max
-    // m[11]= unit
-    // m[12]= receivers
-
-    name := m[1]
-    muxSpec := m[2] // e.g. "", "M", "m1"
-    start, _ := strconv.Atoi(m[3])
-    length, _ := strconv.Atoi(m[4])
-    endian := BigEndian
-    if m[5] == "1" {
-        endian = LittleEndian
-    }
-    isSigned := (m[6] == "-")
-    factor, _ := strconv.ParseFloat(m[7], 64)
-    offset, _ := strconv.ParseFloat(m[8], 64)
-    minv, _ := strconv.ParseFloat(m[9], 64)
-    maxv, _ := strconv.ParseFloat(m[10], 64)
-    unit := m[11]
-    receivers := strings.FieldsFunc(m[12], func(r rune) bool {
-        return r == ',' || r == ' '
-    })
+    // SG_ lines are most of a file and short: lexing them into an array on
+    // the stack saves the write barriers of the shared heap buffer
+    var buf [32]token
+    toks, err := tokenize(buf[:0], line)
+    if err != nil {
+        return err
+    }
+    ts := &tokenStream{toks: toks}
+    ts.next() // SG_
 
-    sig := Signal{
-        Name:       name,
-        StartBit:   start,
-        Length:     length,
-        Endianness: endian,
-        IsSigned:   isSigned,
-        Factor:     factor,
-        Offset:     offset,
-        Minimum:    minv,
-        Maximum:    maxv,
-        Unit:       unit,
-        Receivers:  receivers,
-    }
-
-    // Handle mux
-    if muxSpec != "" {
-        if strings.ToUpper(muxSpec) == "M" {
-            sig.MuxType = MuxSwitch
-        } else {
-            sig.MuxType = MuxSignal
-            // strip leading 'm' or 'M'
-            val, err := strconv.Atoi(muxSpec[1:])
-            if err == nil {
-                sig.MuxValue = val
+    name, err := ts.expect(tokIdent, "signal name")
+    if err != nil {
+        return fmt.Errorf("invalid SG_ line: %w", err)
+    }
+    sig := Signal{Name: name.text, Source: p.span()}
+
+    // optional multiplexer indicator: M, m<n> or m<n>M
+    if t := ts.peek(); t.kind == tokIdent {
+        ts.next()
+        if sig.MuxType, sig.MuxValue, err = parseMuxIndicator(t.text); err != nil {
+            return fmt.Errorf("invalid SG_ line: %w", &posError{t.line, t.col, err})
+        }
+    }
+    if !ts.accept(":") {
+        return fmt.Errorf("invalid SG_ line: %w", ts.errorf("expected \":\" after %s, got %s", sig.Name, ts.peek()))
+    }
+
+    // <start>|<length>@<endianness><sign>
+    start, err := expectInt(ts, "start bit")
+    if err != nil {
+        return fmt.Errorf("invalid SG_ line: %w", err)
+    }
+    if !ts.accept("|") {
+        return fmt.Errorf("invalid SG_ line: %w", ts.errorf("expected \"|\", got %s", ts.peek()))
+    }
+    length, err := expectInt(ts, "length")
+    if err != nil {
+        return fmt.Errorf("invalid SG_ line: %w", err)
+    }
+    if !ts.accept("@") {
+        return fmt.Errorf("invalid SG_ line: %w", ts.errorf("expected \"@\", got %s", ts.peek()))
+    }
+    switch t := ts.next(); {
+    case t.kind == tokNumber && t.text == "0":
+        sig.Endianness = BigEndian
+    case t.kind == tokNumber && t.text == "1":
+        sig.Endianness = LittleEndian
+    default:
+        return fmt.Errorf("invalid SG_ line: %w", &posError{t.line, t.col, fmt.Errorf("expected byte order 0 or 1, got %s", t)})
+    }
+    switch {
+    case ts.accept("+"):
+    case ts.accept("-"):
+        sig.IsSigned = true
+    default:
+        return fmt.Errorf("invalid SG_ line: %w", ts.errorf("expected sign + or -, got %s", ts.peek()))
+    }
+    sig.StartBit, sig.Length = start, length
+
+    // (<factor>,<offset>) [<min>|<max>] "<unit>"
+    var bounds [4]float64
+    before := [4][]string{{"("}, {","}, {")", "["}, {"|"}}
+    for i, what := range [4]string{"factor", "offset", "minimum", "maximum"} {
+        for _, punct := range before[i] {
+            if !ts.accept(punct) {
+                return fmt.Errorf("invalid SG_ line: %w", ts.errorf("expected %q, got %s", punct, ts.peek()))
             }
         }
+        if bounds[i], err = expectFloat(ts, what); err != nil {
+            return fmt.Errorf("invalid SG_ line: %w", err)
+        }
+    }
+    if !ts.accept("]") {
+        return fmt.Errorf("invalid SG_ line: %w", ts.errorf("expected \"]\", got %s", ts.peek()))
+    }
+    sig.Factor, sig.Offset, sig.Minimum, sig.Maximum = bounds[0], bounds[1], bounds[2], bounds[3]
+    unit, err := ts.expect(tokString, "unit")
+    if err != nil {
+        return fmt.Errorf("invalid SG_ line: %w", err)
+    }
+    sig.Unit = unit.text
+
+    // receivers, separated by commas or spaces
+    var rxBuf [8]string
+    receivers := rxBuf[:0]
+    for i := 0; !ts.atEnd(); i++ {
+        if ts.accept(",") != (i > 0) {
+            p.deviatef(ts.peek(), "receivers must be separated by \",\"")
+        }
+        rx, err := ts.expect(tokIdent, "receiver")
+        if err != nil {
+            return fmt.Errorf("invalid SG_ line: %w", err)
+        }
+        p.checkNode(rx, "receiver")
+        receivers = append(receivers, rx.text)
+    }
+    sig.Receivers = p.nameList(receivers)
+    if len(sig.Receivers) == 0 {
+        p.deviatef(ts.peek(), "SG_ %s has no receiver; use Vector__XXX", sig.Name)
     }
 
     // Append to last message
     if len(p.file.Messages) == 0 {
         return fmt.Errorf("SG_ without preceding BO_")
     }
-    lastIdx := len(p.file.Messages) - 1
-    p.file.Messages[lastIdx].Signals = append(
-        p.file.Messages[lastIdx].Signals, sig,
-    )
+    p.signals = append(p.signals, sig)
     return nil
 }
+
+// nameList copies names into a block shared by the lists of many
+// signals, which saves an allocation per signal. The list is capped, so
+// appending to it later copies it first.
+func (p *Parser) nameList(names []string) []string {
+    if len(names) == 0 {
+        return nil
+    }
+    if len(p.names)+len(names) > cap(p.names) {
+        p.names = make([]string, 0, max(1024, len(names)))
+    }
+    start := len(p.names)
+    p.names = append(p.names, names...)
+    return p.names[start:len(p.names):len(p.names)]
+}
+
+// flushSignals moves the signals collected since the last BO_ to it.
+// Collecting them in a reused buffer allocates each message's signals
+// once instead of growing the slice signal by signal.
+func (p *Parser) flushSignals() {
+    if len(p.signals) == 0 {
+        return
+    }
+    msg := &p.file.Messages[len(p.file.Messages)-1]
+    msg.Signals = append(msg.Signals, p.signals...)
+    clear(p.signals)
+    p.signals = p.signals[:0]
+}
@@ -0,0 +1,987 @@
+package dbc
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "reflect"
+    "strconv"
+    "strings"
+    "testing"
+)
+
+// mustParse parses src with the default options
+func mustParse(t *testing.T, src string) *DBCFile {
+    t.Helper()
+    f, err := NewParser().Parse(strings.NewReader(src))
+    if err != nil {
+        t.Fatalf("Parse: %v", err)
+    }
+    return f
+}
+
+// clearAttributeSources zeroes the spans of attribute definitions and
+// values, so parsed and round-tripped models can be compared
+func clearAttributeSources(f *DBCFile) {
+    for i := range f.Attributes {
+        f.Attributes[i].Source = SourceSpan{}
+        f.Attributes[i].DefaultSource = SourceSpan{}
+    }
+    for i := range f.AttrValues {
+        f.AttrValues[i].Source = SourceSpan{}
+    }
+}
+
+func TestParseAttributeDefs(t *testing.T) {
+    f := mustParse(t, `BA_DEF_ "BusType" STRING ;
+BA_DEF_ BU_ "NodeAddress" HEX 0 255;
+BA_DEF_ BO_ "GenMsgCycleTime" INT 0 65535;
+BA_DEF_ SG_ "GenSigStartValue" FLOAT -1.5 1e9;
+BA_DEF_ EV_ "EnvMode" ENUM "Off","On";
+`)
+    want := []AttributeDefinition{
+        {Name: "BusType", DataType: AttrString},
+        {Name: "NodeAddress", DataType: AttrHex, AppliesTo: []string{"BU_"}, Maximum: 255},
+        {Name: "GenMsgCycleTime", DataType: AttrInt, AppliesTo: []string{"BO_"}, Maximum: 65535},
+        {Name: "GenSigStartValue", DataType: AttrFloat, AppliesTo: []string{"SG_"}, Minimum: -1.5, Maximum: 1e9},
+        {Name: "EnvMode", DataType: AttrEnum, AppliesTo: []string{"EV_"}, EnumValues: []string{"Off", "On"}},
+    }
+    clearAttributeSources(f)
+    if !reflect.DeepEqual(f.Attributes, want) {
+        t.Fatalf("parsed:\n got %+v\nwant %+v", f.Attributes, want)
+    }
+
+    got := roundTrip(t, f)
+    clearAttributeSources(got)
+    if !reflect.DeepEqual(got.Attributes, want) {
+        t.Errorf("round trip:\n got %+v\nwant %+v", got.Attributes, want)
+    }
+
+    for _, bad := range []string{
+        `BA_DEF_ BO_ "X" INT 0;`,
+        `BA_DEF_ BO_ "X" INT a b;`,
+        `BA_DEF_ BO_ X INT 0 1;`,
+        `BA_DEF_ "X" STRING 5;`,
+        `BA_DEF_ BO_ "X" ENUM "A","B" junk;`,
+        `BA_DEF_ BO_ "X" ENUM "A","B" "C";`,
+        "BA_DEF_ BO_ \"X\" ENUM \"A\",\n\"B\";",
+    } {
+        if _, err := NewParser().Parse(strings.NewReader(bad)); err == nil {
+            t.Errorf("accepted %q", bad)
+        }
+    }
+}
+
+func TestLenientDiagnostics(t *testing.T) {
+    src := `VERSION "1"
+
+BU_: A B
+
+BO_ 100 M1: 8 A
+ SG_ S1 : 0|8@1+ (1,0) [0|255] "" B
+
+BO_ 200 M2 8 B
+ SG_ S2 : 0|8@1+ (1,0) [0|255] "" A
+
+VAL_ 300 S3 1 "one" ;
+CM_ BO_ 100 "kept";
+`
+    if _, err := NewParser().Parse(strings.NewReader(src)); err == nil {
+        t.Fatal("strict parse accepted a malformed BO_")
+    }
+
+    f, err := NewParserWithOptions(ParseOptions{Lenient: true}).Parse(strings.NewReader(src))
+    if err != nil {
+        t.Fatalf("lenient parse: %v", err)
+    }
+    if len(f.Messages) != 1 || len(f.Messages[0].Signals) != 1 || len(f.Comments) != 1 {
+        t.Errorf("partial file lost statements: %d messages, %d comments", len(f.Messages), len(f.Comments))
+    }
+
+    want := []Diagnostic{
+        {Line: 8, Column: 12, Severity: SeverityError, Code: CodeSyntax},
+        {Line: 9, Column: 2, Severity: SeverityWarning, Code: CodeOrphanSignal},
+        {Line: 11, Column: 1, Severity: SeverityError, Code: CodeUnknownReference},
+    }
+    if len(f.Diagnostics) != len(want) {
+        t.Fatalf("got %d diagnostics, want %d: %v", len(f.Diagnostics), len(want), f.Diagnostics)
+    }
+    for i, d := range f.Diagnostics {
+        d.Message = ""
+        if d != want[i] {
+            t.Errorf("diagnostic %d = %+v, want %+v", i, d, want[i])
+        }
+    }
+}
+
+func TestSourceSpans(t *testing.T) {
+    src := "BU_: A  B\n" +
+        "\n" +
+        "BO_ 100 M1: 8 A\n" +
+        "  SG_ S1 : 0|8@1+ (1,0) [0|255] \"\" B\n" +
+        "  SG_ S0 M : 8|8@1+ (1,0) [0|255] \"\" B\n" +
+        "CM_ BO_ 100 \"first\n" +
+        "second\";\n" +
+        "BS_:\n" +
+        "EV_ E1: 0 [0|0] \"\" 0 1 DUMMY_NODE_VECTOR8000 A;\n" +
+        "ENVVAR_DATA_ E1: 4;\n" +
+        "BA_DEF_ BO_ \"Cycle\" INT 0 100;\n" +
+        "BA_DEF_DEF_ \"Cycle\" 10;\n" +
+        "BO_TX_BU_ 100 : A,B;\n" +
+        "VAL_ 100 S1 0 \"off\" 1 \"on\";\n" +
+        "VAL_ E1 0 \"none\";\n" +
+        "SIG_VALTYPE_ 100 S1 : 1;\n" +
+        "SG_MUL_VAL_ 100 S1 S0 1-2;\n"
+    f, err := NewParserWithOptions(ParseOptions{FileName: "x.dbc"}).Parse(strings.NewReader(src))
+    if err != nil {
+        t.Fatal(err)
+    }
+    tests := []struct {
+        what string
+        got  SourceSpan
+        want SourceSpan
+    }{
+        {"node B", f.Nodes[1].Source, SourceSpan{"x.dbc", 1, 9, 1, 9}},
+        {"message", f.Messages[0].Source, SourceSpan{"x.dbc", 3, 1, 3, 15}},
+        {"signal", f.Messages[0].Signals[0].Source, SourceSpan{"x.dbc", 4, 3, 4, 36}},
+        {"comment", f.Comments[0].Source, SourceSpan{"x.dbc", 6, 1, 7, 8}},
+        {"bit timing", f.BitTimingSource, SourceSpan{"x.dbc", 8, 1, 8, 4}},
+        {"env var data", f.EnvVars[0].DataSizeSource, SourceSpan{"x.dbc", 10, 1, 10, 19}},
+        {"attribute default", f.Attributes[0].DefaultSource, SourceSpan{"x.dbc", 12, 1, 12, 23}},
+        {"transmitters", f.Messages[0].TransmittersSource, SourceSpan{"x.dbc", 13, 1, 13, 20}},
+        {"value descriptions", f.Messages[0].Signals[0].ValueDescriptionsSource, SourceSpan{"x.dbc", 14, 1, 14, 27}},
+        {"env var values", f.EnvVars[0].ValueDescriptionsSource, SourceSpan{"x.dbc", 15, 1, 15, 17}},
+        {"value type", f.Messages[0].Signals[0].ValueTypeSource, SourceSpan{"x.dbc", 16, 1, 16, 24}},
+        {"mux ranges", f.Messages[0].Signals[0].MuxSource, SourceSpan{"x.dbc", 17, 1, 17, 26}},
+    }
+    for _, tt := range tests {
+        if tt.got != tt.want {
+            t.Errorf("%s: got %+v, want %+v", tt.what, tt.got, tt.want)
+        }
+    }
+}
+
+func TestStrictConformance(t *testing.T) {
+    src := "VERSION \"\"\n" +
+        "\n" +
+        "NS_ :\n" +
+        "\tCM_\n" +
+        "\tFOO_\n" +
+        "\n" +
+        "BU_: A B\n" +
+        "\n" +
+        "BO_ 100 M1: 8 A\n" +
+        " SG_ S1 : 0|8@1+ (1,0) [0|255] \"\" B C\n" +
+        "BO_ 2048 M2: 8\n" +
+        "\n" +
+        "CM_ BO_ 100 \"no semicolon\"\n" +
+        "BS_:\n" +
+        "XYZ_ whatever;\n" +
+        "SIG_VALTYPE_ 100 S1 0;\n"
+
+    f, err := NewParser().Parse(strings.NewReader(src))
+    if err != nil || len(f.Diagnostics) != 0 {
+        t.Fatalf("default parse: %v %v", err, f.Diagnostics)
+    }
+    if _, err := NewParserWithOptions(ParseOptions{Strict: true}).Parse(strings.NewReader(src)); err == nil {
+        t.Fatal("strict parse accepted a nonconformant file")
+    }
+
+    f, err = NewParserWithOptions(ParseOptions{Strict: true, Lenient: true}).Parse(strings.NewReader(src))
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []struct {
+        line, col int
+        message   string
+    }{
+        {5, 2, `unknown NS_ symbol "FOO_"`},
+        {7, 1, `missing BS_: before BU_`},
+        {10, 37, `receivers must be separated by ","`},
+        {10, 37, `receiver "C" is not declared in BU_`},
+        {11, 5, `message ID 2048 does not fit 11 bits; set bit 31 for an extended frame`},
+        {11, 1, `BO_ M2 has no transmitter; use Vector__XXX`},
+        {13, 27, `CM_ must end with ";"`},
+        {14, 1, `BS_ must come before CM_`},
+        {15, 1, `unknown keyword "XYZ_"`},
+        {16, 21, `expected ":" before the value type`},
+    }
+    if len(f.Diagnostics) != len(want) {
+        t.Fatalf("got %d diagnostics, want %d: %v", len(f.Diagnostics), len(want), f.Diagnostics)
+    }
+    for i, d := range f.Diagnostics {
+        w := want[i]
+        if d.Line != w.line || d.Column != w.col || d.Message != w.message || d.Code != CodeNonconformant {
+            t.Errorf("diagnostic %d = %v, want %d:%d: %s", i, d, w.line, w.col, w.message)
+        }
+    }
+}
+
+// TestStrictWriterOutput checks that files the writer produces conform
+func TestStrictWriterOutput(t *testing.T) {
+    src := `VERSION "1.0"
+BU_ A B
+VAL_TABLE_ OnOff 0 "Off" 1 "On"
+BO_ 100 M1: 8 A
+ SG_ Mux M : 0|4@1+ (1,0) [0|15] "" B
+ SG_ S1 m1 : 8|8@1- (0.5,-10) [-10|117.5] "km/h" A B
+BO_ 2147484672 M2: 8 B
+ SG_ F : 0|32@1+ (1,0) [0|0] "" A
+BO_TX_BU_ 100 : A,B
+EV_ E1: 0 [0|10] "" 0 1 DUMMY_NODE_VECTOR0 A
+CM_ SG_ 100 S1 "speed"
+BA_DEF_ BO_ "GenMsgCycleTime" INT 0 1000
+BA_DEF_DEF_ "GenMsgCycleTime" 100
+BA_ "GenMsgCycleTime" BO_ 100 20
+VAL_ 100 S1 0 "Zero"
+SIG_VALTYPE_ 2147484672 F 1
+SIG_GROUP_ 100 G 1 : S1
+SG_MUL_VAL_ 100 S1 Mux 1-1
+`
+    f, err := NewParser().Parse(strings.NewReader(src))
+    if err != nil {
+        t.Fatal(err)
+    }
+    var buf bytes.Buffer
+    if _, err := f.WriteTo(&buf); err != nil {
+        t.Fatal(err)
+    }
+    g, err := NewParserWithOptions(ParseOptions{Strict: true, Lenient: true}).Parse(&buf)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, d := range g.Diagnostics {
+        t.Errorf("written file: %v", d)
+    }
+}
+
+// TestStrictRelations checks that the relation statements CANdb++ writes
+// next to BA_REL_ conform
+func TestStrictRelations(t *testing.T) {
+    src := `VERSION ""
+
+NS_ :
+	BA_DEF_REL_
+	BA_REL_
+	BA_DEF_DEF_REL_
+	BU_SG_REL_
+	BU_EV_REL_
+	BU_BO_REL_
+
+BS_:
+
+BU_: Engine Dash
+
+BO_ 256 EngineData: 8 Engine
+ SG_ Speed : 0|16@1+ (0.25,0) [0|16383.75] "rpm" Dash
+
+EV_ Env: 0 [0|10] "" 0 1 DUMMY_NODE_VECTOR0 Dash;
+
+BA_DEF_REL_ BU_SG_REL_ "GenSigTimeoutTime" INT 0 65535;
+BA_DEF_REL_ BU_BO_REL_ "GenMsgTimeout" INT 0 65535;
+BA_DEF_DEF_REL_ "GenSigTimeoutTime" 0;
+BA_DEF_DEF_REL_ "GenMsgTimeout" 0;
+BA_REL_ "GenSigTimeoutTime" BU_SG_REL_ Dash SG_ 256 Speed 500;
+BA_REL_ "GenMsgTimeout" BU_BO_REL_ Dash 256 100;
+BU_SG_REL_ Dash SG_ 256 Speed ;
+BU_EV_REL_ Dash Env ;
+BU_BO_REL_ Dash 256 ;
+`
+    f, err := NewParserWithOptions(ParseOptions{Strict: true, Lenient: true}).Parse(strings.NewReader(src))
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, d := range f.Diagnostics {
+        t.Errorf("unexpected diagnostic: %v", d)
+    }
+
+    // without its ";" a relation is still flagged
+    bad := strings.Replace(src, "BU_BO_REL_ Dash 256 ;", "BU_BO_REL_ Dash 256", 1)
+    f, err = NewParserWithOptions(ParseOptions{Strict: true, Lenient: true}).Parse(strings.NewReader(bad))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(f.Diagnostics) != 1 || f.Diagnostics[0].Message != `BU_BO_REL_ must end with ";"` {
+        t.Errorf("got %v, want one missing \";\" diagnostic", f.Diagnostics)
+    }
+}
+
+// syntheticDBC generates a file with the given number of messages, each
+// with 16 signals, value descriptions, comments and attributes. long adds
+// a 20000 entry VAL_TABLE_ and a 20000 line comment.
+func syntheticDBC(messages int, long bool) []byte {
+    var b bytes.Buffer
+    b.WriteString("VERSION \"\"\n\nNS_ :\n\tCM_\n\tBA_DEF_\n\tBA_\n\tVAL_\n\nBS_:\n\nBU_: ECU1 ECU2\n\n")
+    if long {
+        b.WriteString("VAL_TABLE_ Big")
+        for i := 0; i < 20000; i++ {
+            fmt.Fprintf(&b, " %d \"Value %d\"", i, i)
+        }
+        b.WriteString(";\n\n")
+    }
+    for m := 0; m < messages; m++ {
+        fmt.Fprintf(&b, "BO_ %d Msg%d: 8 ECU1\n", m+1, m)
+        for s := 0; s < 16; s++ {
+            fmt.Fprintf(&b, " SG_ Sig%d_%d : %d|4@1+ (0.5,-10) [-10|0] \"km/h\" ECU2\n", m, s, s*4)
+        }
+        b.WriteString("\n")
+    }
+    if long {
+        b.WriteString("CM_ \"")
+        for i := 0; i < 20000; i++ {
+            fmt.Fprintf(&b, "line %d\n", i)
+        }
+        b.WriteString("\";\n")
+    }
+    b.WriteString("BA_DEF_ BO_ \"GenMsgCycleTime\" INT 0 65535;\nBA_DEF_DEF_ \"GenMsgCycleTime\" 100;\n")
+    for m := 0; m < messages; m++ {
+        fmt.Fprintf(&b, "CM_ BO_ %d \"Message %d\nsecond line\";\n", m+1, m)
+        fmt.Fprintf(&b, "BA_ \"GenMsgCycleTime\" BO_ %d %d;\n", m+1, 10*m)
+        fmt.Fprintf(&b, "VAL_ %d Sig%d_0 0 \"Off\" 1 \"On\" 2 \"Error\" ;\n", m+1, m)
+    }
+    return b.Bytes()
+}
+
+func TestParseLongLines(t *testing.T) {
+    src := syntheticDBC(10, true)
+    f, err := NewParser().Parse(bytes.NewReader(src))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if n := len(f.ValueTables[0].Values); n != 20000 {
+        t.Errorf("got %d value table entries, want 20000", n)
+    }
+    if n := strings.Count(f.Comments[0].Text, "\n"); n != 20000 {
+        t.Errorf("got %d comment lines, want 20000", n)
+    }
+}
+
+// BenchmarkParse parses synthetic files of about 2.4 and 24 MB, each with
+// one 280 KB VAL_TABLE_ line and a 20000-line comment, with and without
+// keeping the source for a preserving save
+func BenchmarkParse(b *testing.B) {
+    for _, messages := range []int{2000, 20000} {
+        src := syntheticDBC(messages, true)
+        for _, keep := range []bool{false, true} {
+            b.Run(fmt.Sprintf("messages=%d/keep=%t", messages, keep), func(b *testing.B) {
+                b.SetBytes(int64(len(src)))
+                b.ReportAllocs()
+                for i := 0; i < b.N; i++ {
+                    p := NewParserWithOptions(ParseOptions{KeepSource: keep})
+                    if _, err := p.Parse(bytes.NewReader(src)); err != nil {
+                        b.Fatal(err)
+                    }
+                }
+            })
+        }
+    }
+}
+
+// BenchmarkParseTypical parses a file without very long statements using
+// only NewParser and Parse, so the same benchmark also runs against older
+// versions of the parser, which had a line length limit
+func BenchmarkParseTypical(b *testing.B) {
+    src := syntheticDBC(2000, false)
+    b.SetBytes(int64(len(src)))
+    b.ReportAllocs()
+    for i := 0; i < b.N; i++ {
+        if _, err := NewParser().Parse(bytes.NewReader(src)); err != nil {
+            b.Fatal(err)
+        }
+    }
+}
+
+// attributeSample defines and assigns one attribute per object type
+const attributeSample = `BU_: ECU1 ECU2
+
+BO_ 100 Msg: 8 ECU1
+ SG_ Sig : 0|8@1+ (1,0) [0|255] "" ECU2
+
+EV_ Env: 0 [0|10] "" 0 1 DUMMY_NODE_VECTOR0 ECU1;
+
+BA_DEF_ "BusType" STRING ;
+BA_DEF_ BU_ "NodeAddress" INT 0 255;
+BA_DEF_ BO_ "GenMsgCycleTime" INT 0 65535;
+BA_DEF_ SG_ "GenSigStartValue" INT 0 255;
+BA_DEF_ EV_ "EnvMode" ENUM "Off","On";
+BA_DEF_DEF_ "BusType" "CAN";
+BA_DEF_DEF_ "NodeAddress" 0;
+BA_DEF_DEF_ "GenMsgCycleTime" 100;
+BA_DEF_DEF_ "GenSigStartValue" 0;
+BA_DEF_DEF_ "EnvMode" "Off";
+BA_ "BusType" "CAN \"FD\"";
+BA_ "NodeAddress" BU_ ECU2 17;
+BA_ "GenMsgCycleTime" BO_ 100 20;
+BA_ "GenSigStartValue" SG_ 100 Sig 7;
+BA_ "EnvMode" EV_ Env 1;
+`
+
+func TestParseAttributeValues(t *testing.T) {
+    f := mustParse(t, attributeSample)
+    want := []AttributeValue{
+        {AttrName: "BusType", Value: `CAN "FD"`},
+        {ObjectType: "BU_", ObjectName: "ECU2", AttrName: "NodeAddress", Value: "17"},
+        {ObjectType: "BO_", ObjectName: "100", AttrName: "GenMsgCycleTime", Value: "20"},
+        {ObjectType: "SG_", ObjectName: "100 Sig", AttrName: "GenSigStartValue", Value: "7"},
+        {ObjectType: "EV_", ObjectName: "Env", AttrName: "EnvMode", Value: "1"},
+    }
+    clearAttributeSources(f)
+    if !reflect.DeepEqual(f.AttrValues, want) {
+        t.Fatalf("parsed:\n got %+v\nwant %+v", f.AttrValues, want)
+    }
+
+    got := roundTrip(t, f)
+    clearAttributeSources(got)
+    if !reflect.DeepEqual(got.AttrValues, want) {
+        t.Errorf("round trip:\n got %+v\nwant %+v", got.AttrValues, want)
+    }
+
+    // references to objects that do not exist
+    for _, bad := range []string{
+        `BA_ "NodeAddress" BU_ ECU3 1;`,
+        `BA_ "GenMsgCycleTime" BO_ 101 1;`,
+        `BA_ "GenSigStartValue" SG_ 100 Other 1;`,
+        `BA_ "EnvMode" EV_ Other 1;`,
+    } {
+        _, err := NewParser().Parse(strings.NewReader(attributeSample + bad + "\n"))
+        var coded *codedError
+        if !errors.As(err, &coded) || coded.code != CodeUnknownReference {
+            t.Errorf("%q: got %v, want an unknown reference", bad, err)
+        }
+    }
+}
+
+func TestAttributeDefaults(t *testing.T) {
+    f := mustParse(t, attributeSample+`
+BO_ 200 Other: 8 ECU1
+ SG_ Sig : 0|8@1+ (1,0) [0|255] "" ECU2
+`)
+    for _, f := range []*DBCFile{f, roundTrip(t, f)} {
+        tests := []struct {
+            what string
+            get  func() (string, error)
+            want string
+        }{
+            {"network override", func() (string, error) { return f.NetworkAttribute("BusType") }, `CAN "FD"`},
+            {"node override", func() (string, error) { return f.NodeAttribute("ECU2", "NodeAddress") }, "17"},
+            {"node default", func() (string, error) { return f.NodeAttribute("ECU1", "NodeAddress") }, "0"},
+            {"message override", func() (string, error) { return f.MessageAttribute(100, "GenMsgCycleTime") }, "20"},
+            {"message default", func() (string, error) { return f.MessageAttribute(200, "GenMsgCycleTime") }, "100"},
+            {"signal override", func() (string, error) { return f.SignalAttribute(100, "Sig", "GenSigStartValue") }, "7"},
+            {"signal default", func() (string, error) { return f.SignalAttribute(200, "Sig", "GenSigStartValue") }, "0"},
+            {"enum override", func() (string, error) { return f.EffectiveAttribute("EV_", "Env", "EnvMode") }, "On"},
+        }
+        for _, tt := range tests {
+            got, err := tt.get()
+            if err != nil || got != tt.want {
+                t.Errorf("%s: got %q, %v; want %q", tt.what, got, err, tt.want)
+            }
+        }
+        if _, err := f.MessageAttribute(100, "NodeAddress"); err == nil {
+            t.Error("BU_ attribute resolved on a message")
+        }
+        if _, err := f.MessageAttribute(100, "Missing"); err == nil {
+            t.Error("undefined attribute resolved")
+        }
+    }
+
+    _, err := NewParser().Parse(strings.NewReader(`BA_DEF_DEF_ "Missing" 1;` + "\n"))
+    var coded *codedError
+    if !errors.As(err, &coded) || coded.code != CodeUnknownReference {
+        t.Errorf("default for an undefined attribute: got %v, want an unknown reference", err)
+    }
+}
+
+func TestParseValueDescriptions(t *testing.T) {
+    f := mustParse(t, `BU_: ECU1
+
+BO_ 100 Gear: 8 ECU1
+ SG_ GearPos : 0|8@1+ (1,0) [0|255] "" ECU1
+
+EV_ Env: 0 [0|10] "" 0 1 DUMMY_NODE_VECTOR0 ECU1;
+
+VAL_ 100 GearPos -1 "SNA" 0 "Park" 1 "Reverse; R=1" 2 "say \"hi\"" ;
+VAL_ Env 0 "Off" 1 "On" ;
+`)
+    wantSig := map[int]string{-1: "SNA", 0: "Park", 1: "Reverse; R=1", 2: `say "hi"`}
+    wantEnv := map[int]string{0: "Off", 1: "On"}
+    for _, f := range []*DBCFile{f, roundTrip(t, f)} {
+        if got := f.MessageByID(100).SignalByName("GearPos").ValueDescriptions; !reflect.DeepEqual(got, wantSig) {
+            t.Errorf("signal values: got %v, want %v", got, wantSig)
+        }
+        if got := f.EnvVarByName("Env").ValueDescriptions; !reflect.DeepEqual(got, wantEnv) {
+            t.Errorf("environment values: got %v, want %v", got, wantEnv)
+        }
+    }
+
+    for _, bad := range []string{
+        `VAL_ 101 GearPos 0 "Park" ;`,
+        `VAL_ 100 Other 0 "Park" ;`,
+        `VAL_ Other 0 "Off" ;`,
+    } {
+        _, err := NewParser().Parse(strings.NewReader("BU_: ECU1\nBO_ 100 Gear: 8 ECU1\n SG_ GearPos : 0|8@1+ (1,0) [0|255] \"\" ECU1\n" + bad + "\n"))
+        var coded *codedError
+        if !errors.As(err, &coded) || coded.code != CodeUnknownReference {
+            t.Errorf("%q: got %v, want an unknown reference", bad, err)
+        }
+    }
+}
+
+func TestParseValueTablesAndComments(t *testing.T) {
+    f := mustParse(t, `BU_: ECU1
+
+VAL_TABLE_ Gears 1 "Reverse" 0 "Park; P" -1 "SNA" ;
+VAL_TABLE_ Empty ;
+
+BO_ 100 Gear: 8 ECU1
+ SG_ GearPos : 0|8@1+ (1,0) [0|255] "" ECU1
+
+EV_ Env: 0 [0|10] "" 0 1 DUMMY_NODE_VECTOR0 ECU1;
+
+CM_ "Network with \"quotes\" and a \\ backslash";
+CM_ BU_ ECU1 "Engine control unit";
+CM_ BO_ 100 "Gear selector state";
+CM_ SG_ 100 GearPos "Current gear position";
+CM_ EV_ Env "Environment";
+CM_ "BO_";
+`)
+    wantTables := []ValueTable{
+        {Name: "Gears", Values: map[int]string{-1: "SNA", 0: "Park; P", 1: "Reverse"}},
+        {Name: "Empty", Values: map[int]string{}},
+    }
+    wantComments := []Comment{
+        {ObjectType: "CM_", Text: `Network with "quotes" and a \ backslash`},
+        {ObjectType: "BU_", ObjectName: "ECU1", Text: "Engine control unit"},
+        {ObjectType: "BO_", ObjectName: "100", Text: "Gear selector state"},
+        {ObjectType: "SG_", ObjectName: "100 GearPos", Text: "Current gear position"},
+        {ObjectType: "EV_", ObjectName: "Env", Text: "Environment"},
+        {ObjectType: "CM_", Text: "BO_"},
+    }
+    for i, f := range []*DBCFile{f, roundTrip(t, f)} {
+        for j := range f.ValueTables {
+            f.ValueTables[j].Source = SourceSpan{}
+            if f.ValueTables[j].Values == nil {
+                f.ValueTables[j].Values = map[int]string{}
+            }
+        }
+        for j := range f.Comments {
+            f.Comments[j].Source = SourceSpan{}
+        }
+        if !reflect.DeepEqual(f.ValueTables, wantTables) {
+            t.Errorf("pass %d: value tables:\n got %+v\nwant %+v", i, f.ValueTables, wantTables)
+        }
+        if !reflect.DeepEqual(f.Comments, wantComments) {
+            t.Errorf("pass %d: comments:\n got %+v\nwant %+v", i, f.Comments, wantComments)
+        }
+    }
+
+    for _, bad := range []string{
+        `VAL_TABLE_ Gears 0 Park ;`,
+        `CM_ BO_ 100 "Trailing" extra;`,
+        `CM_ SG_ 100 "Missing signal";`,
+    } {
+        if _, err := NewParser().Parse(strings.NewReader(bad + "\n")); err == nil {
+            t.Errorf("%q: no error", bad)
+        }
+    }
+}
+
+func TestParseMultiLineStatements(t *testing.T) {
+    src := strings.Join([]string{
+        `BU_: ECU1`,
+        `BO_ 100 Gear: 8 ECU1`,
+        ` SG_ GearPos : 0|8@1+ (1,0) [0|255] "" ECU1`,
+        `CM_ BO_ 100 "first line`,
+        `  indented \"; not the end`,
+        ``,
+        `last line";`,
+        `CM_ SG_ 100 GearPos "single";`,
+        `VAL_ 100 GearPos 0 "Park`,
+        `(P)" 1 "Reverse" ;`,
+        `BA_DEF_ "Note" STRING ;`,
+        `BA_ "Note" "spans`,
+        `two lines";`,
+    }, "\r\n") + "\r\n"
+    f := mustParse(t, src)
+    for i, f := range []*DBCFile{f, roundTrip(t, f)} {
+        if len(f.Comments) != 2 {
+            t.Fatalf("pass %d: got %d comments, want 2", i, len(f.Comments))
+        }
+        if got, want := f.Comments[0].Text, "first line\n  indented \"; not the end\n\nlast line"; got != want {
+            t.Errorf("pass %d: comment = %q, want %q", i, got, want)
+        }
+        if got, want := f.Comments[1].Text, "single"; got != want {
+            t.Errorf("pass %d: comment = %q, want %q", i, got, want)
+        }
+        if got, want := f.MessageByID(100).SignalByName("GearPos").ValueDescriptions[0], "Park\n(P)"; got != want {
+            t.Errorf("pass %d: value description = %q, want %q", i, got, want)
+        }
+        if got, want := f.AttrValues[0].Value, "spans\ntwo lines"; got != want {
+            t.Errorf("pass %d: attribute value = %q, want %q", i, got, want)
+        }
+    }
+
+    // a string left open swallows the rest of the file
+    f, err := NewParserWithOptions(ParseOptions{Lenient: true}).Parse(strings.NewReader(
+        "BU_: ECU1\nCM_ \"never closed;\nBO_ 100 Gear: 8 ECU1\n"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(f.Diagnostics) != 1 || f.Diagnostics[0].Code != CodeUnterminatedString || f.Diagnostics[0].Line != 2 {
+        t.Errorf("got %+v, want one unterminated string on line 2", f.Diagnostics)
+    }
+    if len(f.Messages) != 0 {
+        t.Errorf("parsed %d messages inside an open string", len(f.Messages))
+    }
+}
+
+func TestParseExtendedIDs(t *testing.T) {
+    // 0x98FEF100 is the extended frame 0x18FEF100
+    f := mustParse(t, `BU_: ECU1
+
+BO_ 2566844672 EEC1: 8 ECU1
+ SG_ EngineSpeed : 24|16@1+ (0.125,0) [0|8031.875] "rpm" ECU1
+
+BO_ 100 Std: 8 ECU1
+ SG_ Sig : 0|8@1+ (1,0) [0|255] "" ECU1
+
+CM_ BO_ 2566844672 "Electronic engine controller 1";
+CM_ SG_ 2566844672 EngineSpeed "Actual engine speed";
+BA_DEF_ BO_ "GenMsgCycleTime" INT 0 65535;
+BA_ "GenMsgCycleTime" BO_ 2566844672 10;
+VAL_ 2566844672 EngineSpeed 65535 "SNA" ;
+`)
+    for i, f := range []*DBCFile{f, roundTrip(t, f)} {
+        msg := f.MessageByID(0x98FEF100)
+        if msg == nil {
+            t.Fatalf("pass %d: extended message not found by raw ID", i)
+        }
+        if msg.ID != 0x18FEF100 || !msg.IsExtended || msg.RawID() != 0x98FEF100 {
+            t.Errorf("pass %d: ID %#x extended %v raw %#x", i, msg.ID, msg.IsExtended, msg.RawID())
+        }
+        if f.MessageByID(0x18FEF100) != nil {
+            t.Errorf("pass %d: extended message found by its 29-bit ID", i)
+        }
+        if std := f.MessageByID(100); std == nil || std.IsExtended || std.RawID() != 100 {
+            t.Errorf("pass %d: standard message %+v", i, std)
+        }
+        if v, err := f.MessageAttribute(0x98FEF100, "GenMsgCycleTime"); err != nil || v != "10" {
+            t.Errorf("pass %d: GenMsgCycleTime = %q, %v", i, v, err)
+        }
+        if got := msg.SignalByName("EngineSpeed").ValueDescriptions[65535]; got != "SNA" {
+            t.Errorf("pass %d: value description = %q", i, got)
+        }
+        if len(f.Comments) != 2 || f.Comments[0].ObjectName != "2566844672" || f.Comments[1].ObjectName != "2566844672 EngineSpeed" {
+            t.Errorf("pass %d: comments %+v", i, f.Comments)
+        }
+    }
+
+    // references use the raw ID, not the 29-bit one
+    _, err := NewParser().Parse(strings.NewReader("BU_: ECU1\nBO_ 2566844672 EEC1: 8 ECU1\n" +
+        " SG_ EngineSpeed : 24|16@1+ (0.125,0) [0|8031.875] \"rpm\" ECU1\n" +
+        "VAL_ 419361024 EngineSpeed 65535 \"SNA\" ;\n"))
+    var coded *codedError
+    if !errors.As(err, &coded) || coded.code != CodeUnknownReference {
+        t.Errorf("VAL_ by 29-bit ID: got %v, want an unknown reference", err)
+    }
+}
+
+func TestParseMessageTransmitters(t *testing.T) {
+    f := mustParse(t, `BU_: A B C
+
+BO_ 100 Shared: 8 A
+ SG_ S : 0|8@1+ (1,0) [0|255] "" C
+
+BO_ 200 Gateway: 8 Vector__XXX
+ SG_ S : 0|8@1+ (1,0) [0|255] "" C
+
+BO_ 300 Unsent: 8 Vector__XXX
+
+BO_TX_BU_ 100 : B,A,C;
+BO_TX_BU_ 200 : B,C;
+`)
+    want := map[uint32][]string{
+        100: {"A", "B", "C"},
+        200: {"B", "C"}, // the placeholder sender is dropped
+        300: {"Vector__XXX"},
+    }
+    for i, f := range []*DBCFile{f, roundTrip(t, f)} {
+        for id, txs := range want {
+            if got := f.MessageByID(id).Transmitters; !reflect.DeepEqual(got, txs) {
+                t.Errorf("pass %d: BO_ %d transmitters %v, want %v", i, id, got, txs)
+            }
+        }
+    }
+
+    // a placeholder left in the model by an edit is not written out
+    f.MessageByID(300).Transmitters = []string{"Vector__XXX", "A", "B"}
+    var buf bytes.Buffer
+    if _, err := f.WriteTo(&buf); err != nil {
+        t.Fatal(err)
+    }
+    for _, line := range []string{"BO_ 300 Unsent: 8 A", "BO_TX_BU_ 300 : A,B;"} {
+        if !strings.Contains(buf.String(), line) {
+            t.Errorf("output lacks %q:\n%s", line, buf.String())
+        }
+    }
+    if strings.Contains(buf.String(), "BO_TX_BU_ 200 : Vector__XXX") {
+        t.Errorf("placeholder written to BO_TX_BU_:\n%s", buf.String())
+    }
+
+    _, err := NewParser().Parse(strings.NewReader("BU_: A\nBO_TX_BU_ 100 : A;\n"))
+    var coded *codedError
+    if !errors.As(err, &coded) || coded.code != CodeUnknownReference {
+        t.Errorf("BO_TX_BU_ for an unknown message: got %v, want an unknown reference", err)
+    }
+}
+
+func TestParseExtendedMultiplexing(t *testing.T) {
+    f := mustParse(t, `BU_: ECU1
+
+BO_ 100 Muxed: 8 ECU1
+ SG_ Mode M : 0|8@1+ (1,0) [0|255] "" ECU1
+ SG_ Sub m1M : 8|8@1+ (1,0) [0|255] "" ECU1
+ SG_ Plain m2 : 8|16@1+ (1,0) [0|65535] "" ECU1
+ SG_ Leaf m3 : 16|8@1+ (1,0) [0|255] "" ECU1
+ SG_ Always : 56|8@1+ (1,0) [0|255] "" ECU1
+
+SG_MUL_VAL_ 100 Sub Mode 1-1;
+SG_MUL_VAL_ 100 Leaf Sub 3-5, 10 - 12;
+SG_MUL_VAL_ 100 Leaf Sub 20-20;
+`)
+    type mux struct {
+        typ    MultiplexerType
+        value  int
+        sw     string
+        ranges []MuxValueRange
+    }
+    want := map[string]mux{
+        "Mode":   {MuxSwitch, 0, "", nil},
+        "Sub":    {MuxSignalSwitch, 1, "Mode", []MuxValueRange{{1, 1}}},
+        "Plain":  {MuxSignal, 2, "", nil},
+        "Leaf":   {MuxSignal, 3, "Sub", []MuxValueRange{{3, 5}, {10, 12}, {20, 20}}},
+        "Always": {NoMux, 0, "", nil},
+    }
+    for i, f := range []*DBCFile{f, roundTrip(t, f)} {
+        for _, s := range f.Messages[0].Signals {
+            got := mux{s.MuxType, s.MuxValue, s.MuxSwitchName, s.MuxRanges}
+            if !reflect.DeepEqual(got, want[s.Name]) {
+                t.Errorf("pass %d: %s = %+v, want %+v", i, s.Name, got, want[s.Name])
+            }
+        }
+        if err := f.Validate(); err != nil {
+            t.Errorf("pass %d: %v", i, err)
+        }
+    }
+
+    for _, bad := range []string{
+        `SG_MUL_VAL_ 100 Leaf Plain 1-1;`, // not a switch
+        `SG_MUL_VAL_ 100 Leaf Sub 1;`,
+        `SG_MUL_VAL_ 100 Missing Sub 1-1;`,
+        `SG_MUL_VAL_ 101 Leaf Sub 1-1;`,
+    } {
+        src := "BU_: ECU1\nBO_ 100 Muxed: 8 ECU1\n SG_ Sub M : 8|8@1+ (1,0) [0|255] \"\" ECU1\n" +
+            " SG_ Plain m2 : 16|8@1+ (1,0) [0|255] \"\" ECU1\n SG_ Leaf m3 : 24|8@1+ (1,0) [0|255] \"\" ECU1\n"
+        if _, err := NewParser().Parse(strings.NewReader(src + bad + "\n")); err == nil {
+            t.Errorf("%q: no error", bad)
+        }
+    }
+}
+
+func TestParseSignalValueTypes(t *testing.T) {
+    f := mustParse(t, `BU_: ECU1
+
+BO_ 100 Floats: 16 ECU1
+ SG_ Int : 0|32@1- (1,0) [0|0] "" ECU1
+ SG_ Single : 32|32@1- (1,0) [0|0] "" ECU1
+ SG_ Double : 64|64@1- (1,0) [0|0] "" ECU1
+
+SIG_VALTYPE_ 100 Single : 1;
+SIG_VALTYPE_ 100 Double : 2;
+SIG_VALTYPE_ 100 Int : 0;
+`)
+    want := map[string]SignalValueType{"Int": ValueInteger, "Single": ValueFloat, "Double": ValueDouble}
+    for i, f := range []*DBCFile{f, roundTrip(t, f)} {
+        for name, vt := range want {
+            if got := f.MessageByID(100).SignalByName(name).ValueType; got != vt {
+                t.Errorf("pass %d: %s value type %d, want %d", i, name, got, vt)
+            }
+        }
+    }
+
+    // integer signals are the default and need no statement
+    var buf bytes.Buffer
+    if _, err := f.WriteTo(&buf); err != nil {
+        t.Fatal(err)
+    }
+    if strings.Contains(buf.String(), "SIG_VALTYPE_ 100 Int") {
+        t.Errorf("SIG_VALTYPE_ written for an integer signal:\n%s", buf.String())
+    }
+
+    for _, bad := range []string{
+        `SIG_VALTYPE_ 100 Single : 3;`,
+        `SIG_VALTYPE_ 100 Missing : 1;`,
+        `SIG_VALTYPE_ 101 Single : 1;`,
+        `SIG_VALTYPE_ 100 Single : 1 2;`,
+    } {
+        src := "BU_: ECU1\nBO_ 100 Floats: 8 ECU1\n SG_ Single : 0|32@1- (1,0) [0|0] \"\" ECU1\n"
+        if _, err := NewParser().Parse(strings.NewReader(src + bad + "\n")); err == nil {
+            t.Errorf("%q: no error", bad)
+        }
+    }
+}
+
+func TestParseEnvironmentVariables(t *testing.T) {
+    f := mustParse(t, `BU_: ECU1 ECU2
+
+EV_ Speed: 0 [0|250] "km/h" 10 1 DUMMY_NODE_VECTOR1 ECU1,ECU2;
+EV_ Ratio: 1 [-1.5|1.5] "" 0.25 2 DUMMY_NODE_VECTOR3 ECU1;
+EV_ Label: 2 [0|0] "" 0 3 DUMMY_NODE_VECTOR0 Vector__XXX;
+EV_ Blob: 0 [0|0] "" 0 4 DUMMY_NODE_VECTOR8002 ECU2;
+
+ENVVAR_DATA_ Blob: 16;
+`)
+    want := []EnvironmentVariable{
+        {Name: "Speed", Type: EnvInteger, Maximum: 250, Unit: "km/h", InitialValue: 10, ID: 1,
+            AccessType: EnvRead, AccessNodes: []string{"ECU1", "ECU2"}},
+        {Name: "Ratio", Type: EnvFloat, Minimum: -1.5, Maximum: 1.5, InitialValue: 0.25, ID: 2,
+            AccessType: EnvReadWrite, AccessNodes: []string{"ECU1"}},
+        {Name: "Label", Type: EnvString, ID: 3, AccessType: EnvUnrestricted, AccessNodes: []string{"Vector__XXX"}},
+        {Name: "Blob", Type: EnvData, ID: 4, AccessType: EnvWrite, AccessNodes: []string{"ECU2"}, DataSize: 16},
+    }
+    for i, f := range []*DBCFile{f, roundTrip(t, f)} {
+        for j := range f.EnvVars {
+            ev := &f.EnvVars[j]
+            ev.Source, ev.DataSizeSource, ev.ValueDescriptionsSource = SourceSpan{}, SourceSpan{}, SourceSpan{}
+        }
+        if !reflect.DeepEqual(f.EnvVars, want) {
+            t.Errorf("pass %d:\n got %+v\nwant %+v", i, f.EnvVars, want)
+        }
+    }
+
+    for _, bad := range []string{
+        `EV_ X: 3 [0|1] "" 0 1 DUMMY_NODE_VECTOR0 ECU1;`,
+        `EV_ X: 0 [0|1] "" 0 1 NODE_VECTOR0 ECU1;`,
+        `EV_ X: 0 [0 1] "" 0 1 DUMMY_NODE_VECTOR0 ECU1;`,
+        `ENVVAR_DATA_ Missing: 8;`,
+    } {
+        if _, err := NewParser().Parse(strings.NewReader("BU_: ECU1\n" + bad + "\n")); err == nil {
+            t.Errorf("%q: no error", bad)
+        }
+    }
+}
+
+func TestParseSignalGroups(t *testing.T) {
+    f := mustParse(t, `BU_: ECU1
+
+BO_ 100 Grouped: 8 ECU1
+ SG_ A : 0|8@1+ (1,0) [0|255] "" ECU1
+ SG_ B : 8|8@1+ (1,0) [0|255] "" ECU1
+ SG_ C : 16|8@1+ (1,0) [0|255] "" ECU1
+
+SIG_GROUP_ 100 Pair 1 : A B;
+SIG_GROUP_ 100 All 3 : C, A, B;
+SIG_GROUP_ 100 Empty 1 :;
+`)
+    want := []SignalGroup{
+        {Name: "Pair", Repetitions: 1, Signals: []string{"A", "B"}},
+        {Name: "All", Repetitions: 3, Signals: []string{"C", "A", "B"}},
+        {Name: "Empty", Repetitions: 1},
+    }
+    for i, f := range []*DBCFile{f, roundTrip(t, f)} {
+        groups := f.MessageByID(100).SignalGroups
+        for j := range groups {
+            groups[j].Source = SourceSpan{}
+        }
+        if !reflect.DeepEqual(groups, want) {
+            t.Errorf("pass %d:\n got %+v\nwant %+v", i, groups, want)
+        }
+    }
+
+    for _, bad := range []string{
+        `SIG_GROUP_ 100 G 1 : A Missing;`,
+        `SIG_GROUP_ 101 G 1 : A;`,
+        `SIG_GROUP_ 100 G x : A;`,
+        `SIG_GROUP_ 100 G 1 A;`,
+    } {
+        src := "BU_: ECU1\nBO_ 100 Grouped: 8 ECU1\n SG_ A : 0|8@1+ (1,0) [0|255] \"\" ECU1\n"
+        if _, err := NewParser().Parse(strings.NewReader(src + bad + "\n")); err == nil {
+            t.Errorf("%q: no error", bad)
+        }
+    }
+}
+
+func TestParseNamespace(t *testing.T) {
+    f := mustParse(t, `VERSION ""
+
+NS_ : NS_DESC_
+	CM_
+	BA_DEF_
+	BA_
+	SG_MUL_VAL_
+
+BS_:
+
+BU_: ECU1
+`)
+    want := []string{"NS_DESC_", "CM_", "BA_DEF_", "BA_", "SG_MUL_VAL_"}
+    if !reflect.DeepEqual(f.NewSymbols, want) {
+        t.Errorf("parsed %v, want %v", f.NewSymbols, want)
+    }
+    if len(f.Nodes) != 1 {
+        t.Errorf("BU_ after the NS_ block: got %d nodes", len(f.Nodes))
+    }
+    if got := roundTrip(t, f).NewSymbols; !reflect.DeepEqual(got, want) {
+        t.Errorf("round trip: got %v, want %v", got, want)
+    }
+
+    // keywords the model needs are added after the declared ones
+    f.Messages = append(f.Messages, Message{ID: 100, Name: "M", DLC: 8, Transmitters: []string{"ECU1", "ECU2"}})
+    want = append(want, "BO_TX_BU_")
+    if got := roundTrip(t, f).NewSymbols; !reflect.DeepEqual(got, want) {
+        t.Errorf("after adding a transmitter: got %v, want %v", got, want)
+    }
+
+    // a file without NS_ gets exactly the symbols it uses
+    f = mustParse(t, "BU_: ECU1\nBO_ 100 M: 8 ECU1\n SG_ S : 0|8@1+ (1,0) [0|255] \"\" ECU1\nVAL_ 100 S 0 \"Off\" ;\nCM_ \"net\";\n")
+    if got, want := roundTrip(t, f).NewSymbols, []string{"CM_", "VAL_"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("without NS_: got %v, want %v", got, want)
+    }
+}
+
+func TestParseNodeList(t *testing.T) {
+    for _, src := range []string{"BU_: A B", "BU_ : A B", "BU_:A\tB;", "BU_ :  A B ;"} {
+        f, err := NewParser().Parse(strings.NewReader(src + "\n"))
+        if err != nil {
+            t.Fatalf("%q: %v", src, err)
+        }
+        var names []string
+        for _, n := range f.Nodes {
+            names = append(names, n.Name)
+        }
+        if !reflect.DeepEqual(names, []string{"A", "B"}) {
+            t.Errorf("%q: got nodes %q, want [A B]", src, names)
+        }
+    }
+
+    f := mustParse(t, "BU_ : A Bee\n")
+    if got, want := f.Nodes[1].Source, (SourceSpan{Line: 1, Column: 9, EndLine: 1, EndColumn: 11}); got != want {
+        t.Errorf("span of Bee: got %+v, want %+v", got, want)
+    }
+    if _, err := NewParser().Parse(strings.NewReader("BU_: A \"B\"\n")); err == nil {
+        t.Error("accepted a quoted node name")
+    }
+}
+
+func TestSmallInt(t *testing.T) {
+    for s, want := range map[string]bool{"0": true, "-10": true, "255": true,
+        "-0": false, "0.5": false, "1e3": false, "-": false, "": false, "1234567890123456": false} {
+        v, ok := smallInt(s)
+        if ok != want {
+            t.Errorf("smallInt(%q) ok = %v, want %v", s, ok, want)
+        }
+        if f, _ := strconv.ParseFloat(s, 64); ok && float64(v) != f {
+            t.Errorf("smallInt(%q) = %d, want %v", s, v, f)
+        }
+    }
+}
@@ -1,133 +1,681 @@
 package dbc
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 )
 
+// SaveOptions controls how a DBCFile is written
+type SaveOptions struct {
+    // PreserveFormatting keeps the original text of every statement whose
+    // model object did not change, so an edit produces a minimal diff.
+    // The file must have been parsed with ParseOptions.KeepSource; writing
+    // any other file this way fails.
+    PreserveFormatting bool
+
+    // Order selects the order messages, signals and the statements about
+    // them are written in. Value descriptions are always sorted by value.
+    // With PreserveFormatting it only decides where new statements go.
+    Order SaveOrder
+
+    // Backup keeps the previous version of the file as <path>.bak
+    Backup bool
+
+    // Encoding to write in; EncodingAuto keeps the encoding the file was
+    // read in, or UTF-8 for files that were not parsed
+    Encoding Encoding
+}
+
 // Save writes the DBCFile to the given path in standard DBC format.
 func (f *DBCFile) Save(path string) error {
-    file, err := os.Create(path)
+    return f.SaveWithOptions(path, SaveOptions{})
+}
+
+// SaveWithOptions writes the DBCFile to the given path. The file is
+// written to a temporary file next to it, synced and renamed over path,
+// and the directory is synced, so a failed save leaves the previous
+// version intact and a completed one survives a crash.
+func (f *DBCFile) SaveWithOptions(path string, opts SaveOptions) error {
+    mode := os.FileMode(0644)
+    if info, err := os.Stat(path); err == nil {
+        mode = info.Mode().Perm()
+        if opts.Backup {
+            if err := copyFile(path, path+".bak", mode); err != nil {
+                return fmt.Errorf("backup: %w", err)
+            }
+        }
+    }
+
+    tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+    if err != nil {
+        return err
+    }
+    // harmless once the rename went through
+    defer os.Remove(tmp.Name())
+
+    bw := bufio.NewWriter(tmp)
+    _, err = f.WriteWithOptions(bw, opts)
+    if err == nil {
+        err = bw.Flush()
+    }
+    if err == nil {
+        err = tmp.Sync()
+    }
+    if cerr := tmp.Close(); err == nil {
+        err = cerr
+    }
+    if err == nil {
+        err = os.Chmod(tmp.Name(), mode)
+    }
+    if err != nil {
+        return err
+    }
+    if err := os.Rename(tmp.Name(), path); err != nil {
+        return err
+    }
+    return syncDir(filepath.Dir(path))
+}
+
+// syncDir flushes a directory entry change such as a rename to disk.
+// Windows cannot sync directories and persists renames itself.
+func syncDir(dir string) error {
+    if runtime.GOOS == "windows" {
+        return nil
+    }
+    d, err := os.Open(dir)
+    if err != nil {
+        return err
+    }
+    err = d.Sync()
+    if cerr := d.Close(); err == nil {
+        err = cerr
+    }
+    return err
+}
+
+// WriteTo writes the DBCFile in canonical DBC format. It implements
+// io.WriterTo.
+func (f *DBCFile) WriteTo(w io.Writer) (int64, error) {
+    return f.WriteWithOptions(w, SaveOptions{})
+}
+
+// WriteWithOptions writes the DBCFile to w and returns the number of bytes
+// written and the first write error. SaveOptions.Backup is ignored.
+func (f *DBCFile) WriteWithOptions(w io.Writer, opts SaveOptions) (int64, error) {
+    enc := opts.Encoding
+    if enc == EncodingAuto {
+        enc = f.Encoding
+    }
+    if enc == EncodingAuto || enc == EncodingUTF8 {
+        return f.writeUTF8(w, opts)
+    }
+
+    cw := &countingWriter{w: w}
+    ew, err := encodeOutput(cw, enc)
+    if err != nil {
+        return 0, err
+    }
+    _, err = f.writeUTF8(ew, opts)
+    if cerr := ew.Close(); err == nil {
+        err = cerr
+    }
+    return cw.n, err
+}
+
+func (f *DBCFile) writeUTF8(w io.Writer, opts SaveOptions) (int64, error) {
+    out := f.sorted(opts.Order)
+    if !opts.PreserveFormatting {
+        return out.write(w)
+    }
+    if f.source == nil {
+        return 0, fmt.Errorf("cannot preserve formatting: the original text was not kept (ParseOptions.KeepSource)")
+    }
+    return out.writePreserving(w)
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+    w io.Writer
+    n int64
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+    n, err := cw.w.Write(b)
+    cw.n += int64(n)
+    return n, err
+}
+
+// copyFile copies src to dst, replacing dst
+func copyFile(src, dst string, mode os.FileMode) error {
+    data, err := os.ReadFile(src)
     if err != nil {
         return err
     }
-    defer file.Close()
+    return os.WriteFile(dst, data, mode)
+}
 
-    // 1) VERSION
-    if f.Version != "" {
-        fmt.Fprintf(file, `VERSION "%s";\n\n`, f.Version)
+// lineWriter writes lines until the first error and counts the bytes
+type lineWriter struct {
+    w   io.Writer
+    n   int64
+    err error
+}
+
+func (lw *lineWriter) line(text, nl string) {
+    if lw.err != nil {
+        return
     }
+    n, err := io.WriteString(lw.w, text+nl)
+    lw.n += int64(n)
+    lw.err = err
+}
+
+// statement is the rendered text of one DBC statement. key identifies the
+// model object it came from (see statementKey), so the same statement can
+// be found again in the original source.
+type statement struct {
+    key  string
+    text string // without trailing newline, may span several lines
+    gap  bool   // preceded by a blank line in canonical output
+}
+
+// saveSection renders one group of statements. Sections are written in
+// the order Vector tools use, so every statement comes after the objects
+// it references.
+type saveSection struct {
+    // keywords of the statements in this section; raw sections that
+    // followed one of them in the original file are re-emitted here
+    keywords []string
+    render   func(f *DBCFile) []statement
+}
+
+// continuedSections follow the previous section without a blank line
+var continuedSections = map[string]bool{"BA_DEF_DEF_": true}
+
+var saveSections = []saveSection{
+    {[]string{"VERSION"}, renderVersion},
+    {[]string{"NS_"}, renderNamespace},
+    {[]string{"BS_"}, renderBitTiming},
+    {[]string{"BU_"}, renderNodes},
+    {[]string{"VAL_TABLE_"}, renderValueTables},
+    {[]string{"BO_", "SG_"}, renderMessages},
+    {[]string{"BO_TX_BU_"}, renderTransmitters},
+    {[]string{"EV_", "ENVVAR_DATA_"}, renderEnvVars},
+    {[]string{"CM_"}, renderComments},
+    {[]string{"BA_DEF_"}, renderAttributeDefs},
+    {[]string{"BA_DEF_DEF_"}, renderAttributeDefaults},
+    {[]string{"BA_"}, renderAttributeValues},
+    {[]string{"VAL_"}, renderValueDescriptions},
+    {[]string{"SIG_VALTYPE_"}, renderSignalValueTypes},
+    {[]string{"SIG_GROUP_"}, renderSignalGroups},
+    {[]string{"SG_MUL_VAL_"}, renderExtendedMux},
+}
 
-    // 2) NS_, BS_, BU_
-    file.WriteString("NS_:\n\n") // minimal: we ignore sub-keywords
+// statements renders the whole file: every section followed by the raw
+// statements that came after it in the parsed file
+func (f *DBCFile) statements() []statement {
+    var out []statement
+    written := map[int]bool{}
+    raw := func(after func(string) bool) []statement {
+        var stmts []statement
+        for i, r := range f.RawSections {
+            if written[i] || !after(r.After) {
+                continue
+            }
+            stmts = append(stmts, statement{
+                key:  rawKey(i),
+                text: strings.Join(r.Lines, "\n"),
+            })
+            written[i] = true
+        }
+        return stmts
+    }
+    add := func(group []statement, gap bool) {
+        if len(group) > 0 {
+            group[0].gap = gap
+            out = append(out, group...)
+        }
+    }
+
+    // statements that preceded anything we understand
+    add(raw(func(k string) bool { return k == "" }), true)
+    for _, sec := range saveSections {
+        add(append(sec.render(f), raw(func(k string) bool { return contains(sec.keywords, k) })...),
+            !continuedSections[sec.keywords[0]])
+    }
+    // anything left over is anchored to a statement we no longer write
+    add(raw(func(string) bool { return true }), true)
+
+    uniqueKeys(out)
+    return out
+}
+
+// write emits the file in canonical layout, separating sections (and
+// messages) by a blank line
+func (f *DBCFile) write(w io.Writer) (int64, error) {
+    lw := &lineWriter{w: w}
+    for i, st := range f.statements() {
+        if st.gap && i > 0 {
+            lw.line("", "\n")
+        }
+        lw.line(st.text, "\n")
+    }
+    return lw.n, lw.err
+}
+
+func renderVersion(f *DBCFile) []statement {
+    return []statement{{key: "VERSION", text: "VERSION " + quoteString(f.Version)}}
+}
+
+func renderNamespace(f *DBCFile) []statement {
+    var sb strings.Builder
+    sb.WriteString("NS_ :")
+    for _, sym := range f.namespaceSymbols() {
+        sb.WriteString("\n\t" + sym)
+    }
+    return []statement{{key: "NS_", text: sb.String()}}
+}
+
+func renderBitTiming(f *DBCFile) []statement {
+    text := "BS_:"
     if len(f.BaudRates) > 0 {
         // write the first bitrate
-        fmt.Fprintf(file, "BS_: %d;\n\n", f.BaudRates[0].Rate)
+        text = fmt.Sprintf("BS_: %d;", f.BaudRates[0].Rate)
     }
-    if len(f.Nodes) > 0 {
-        names := make([]string, len(f.Nodes))
-        for i, n := range f.Nodes {
-            names[i] = n.Name
-        }
-        fmt.Fprintf(file, "BU_: %s;\n\n", strings.Join(names, " "))
+    return []statement{{key: "BS_", text: text}}
+}
+
+func renderNodes(f *DBCFile) []statement {
+    names := make([]string, len(f.Nodes))
+    for i, n := range f.Nodes {
+        names[i] = n.Name
     }
+    return []statement{{key: "BU_", text: strings.TrimSpace("BU_: " + strings.Join(names, " "))}}
+}
 
-    // 3) Value Tables
+func renderValueTables(f *DBCFile) []statement {
+    var out []statement
     for _, vt := range f.ValueTables {
-        parts := []string{}
-        for k, v := range vt.Values {
-            parts = append(parts, fmt.Sprintf("%d \"%s\"", k, v))
+        out = append(out, statement{
+            key:  "VAL_TABLE_ " + vt.Name,
+            text: fmt.Sprintf("VAL_TABLE_ %s %s;", vt.Name, formatValuePairs(vt.Values)),
+        })
+    }
+    return out
+}
+
+func renderMessages(f *DBCFile) []statement {
+    n := len(f.Messages)
+    for _, msg := range f.Messages {
+        n += len(msg.Signals)
+    }
+    out := make([]statement, 0, n)
+    var buf []byte
+    for _, msg := range f.Messages {
+        id := strconv.FormatUint(uint64(msg.RawID()), 10)
+        // BO_ takes a single sender; the rest go to BO_TX_BU_
+        tx := "Vector__XXX"
+        if txs := transmitters(&msg); len(txs) > 0 {
+            tx = txs[0]
+        }
+        out = append(out, statement{
+            key:  "BO_ " + id,
+            text: "BO_ " + id + " " + msg.Name + ": " + strconv.Itoa(msg.DLC) + " " + tx,
+            gap:  true, // blank line between messages
+        })
+        for _, sig := range msg.Signals {
+            buf = appendSignal(buf[:0], &sig)
+            out = append(out, statement{
+                key:  "SG_ " + id + " " + sig.Name,
+                text: string(buf),
+            })
         }
-        fmt.Fprintf(file, "VAL_TABLE_ %s %s;\n", vt.Name, strings.Join(parts, " "))
     }
-    if len(f.ValueTables) > 0 {
-        file.WriteString("\n")
+    return out
+}
+
+// appendSignal appends the SG_ line of sig to buf. Lines are built by hand
+// rather than with Sprintf as large files have tens of thousands of them.
+func appendSignal(buf []byte, sig *Signal) []byte {
+    buf = append(buf, " SG_ "...)
+    buf = append(buf, sig.Name...)
+    switch sig.MuxType {
+    case MuxSwitch:
+        buf = append(buf, " M"...)
+    case MuxSignal, MuxSignalSwitch:
+        buf = append(buf, " m"...)
+        buf = strconv.AppendInt(buf, int64(sig.MuxValue), 10)
+        if sig.MuxType == MuxSignalSwitch {
+            buf = append(buf, 'M')
+        }
+    }
+    buf = append(buf, " : "...)
+    buf = strconv.AppendInt(buf, int64(sig.StartBit), 10)
+    buf = append(buf, '|')
+    buf = strconv.AppendInt(buf, int64(sig.Length), 10)
+    buf = append(buf, '@')
+    if sig.Endianness == LittleEndian {
+        buf = append(buf, '1')
+    } else {
+        buf = append(buf, '0')
+    }
+    if sig.IsSigned {
+        buf = append(buf, '-')
+    } else {
+        buf = append(buf, '+')
     }
+    // %g formatting
+    buf = append(buf, " ("...)
+    buf = strconv.AppendFloat(buf, sig.Factor, 'g', -1, 64)
+    buf = append(buf, ',')
+    buf = strconv.AppendFloat(buf, sig.Offset, 'g', -1, 64)
+    buf = append(buf, ") ["...)
+    buf = strconv.AppendFloat(buf, sig.Minimum, 'g', -1, 64)
+    buf = append(buf, '|')
+    buf = strconv.AppendFloat(buf, sig.Maximum, 'g', -1, 64)
+    buf = append(buf, "] "...)
+    buf = append(buf, quoteString(sig.Unit)...)
+    buf = append(buf, ' ')
+    if len(sig.Receivers) == 0 {
+        return append(buf, "Vector__XXX"...)
+    }
+    for i, r := range sig.Receivers {
+        if i > 0 {
+            buf = append(buf, ',')
+        }
+        buf = append(buf, r...)
+    }
+    return buf
+}
 
-    // 4) Attributes (definitions and values)
-    for _, def := range f.Attributes {
-        appl := strings.Join(def.AppliesTo, " ")
-        if def.DataType == AttrEnum {
-            fmt.Fprintf(file, "BA_DEF_ %s %s ENUM %s ;\n",
-                appl, def.Name, strings.Join(def.EnumValues, " "))
-        } else {
-            dt := map[AttributeDataType]string{
-                AttrInt:    "INT",
-                AttrFloat:  "FLOAT",
-                AttrString: "STRING",
-            }[def.DataType]
-            fmt.Fprintf(file, "BA_DEF_ %s %s %s %s;\n",
-                appl, def.Name, dt, def.DefaultValue)
+func renderTransmitters(f *DBCFile) []statement {
+    var out []statement
+    for _, msg := range f.Messages {
+        if txs := transmitters(&msg); len(txs) > 1 {
+            out = append(out, statement{
+                key:  fmt.Sprintf("BO_TX_BU_ %d", msg.RawID()),
+                text: fmt.Sprintf("BO_TX_BU_ %d : %s;", msg.RawID(), strings.Join(txs, ",")),
+            })
         }
     }
-    if len(f.Attributes) > 0 {
-        file.WriteString("\n")
+    return out
+}
+
+// transmitters returns the senders of msg without the Vector__XXX
+// placeholder, unless it is the only one
+func transmitters(msg *Message) []string {
+    if len(msg.Transmitters) < 2 || !contains(msg.Transmitters, "Vector__XXX") {
+        return msg.Transmitters
     }
-    for _, av := range f.AttrValues {
-        fmt.Fprintf(file, "BA_ %s %s %s %s;\n",
-            av.ObjectType, av.ObjectName, av.AttrName, av.Value)
+    txs := make([]string, 0, len(msg.Transmitters)-1)
+    for _, tx := range msg.Transmitters {
+        if tx != "Vector__XXX" {
+            txs = append(txs, tx)
+        }
+    }
+    return txs
+}
+
+func renderEnvVars(f *DBCFile) []statement {
+    var out []statement
+    for _, ev := range f.EnvVars {
+        typ := ev.Type
+        access := int(ev.AccessType)
+        if ev.Type == EnvData {
+            typ = EnvInteger
+            access |= envDataFlag
+        }
+        nodes := "Vector__XXX"
+        if len(ev.AccessNodes) > 0 {
+            nodes = strings.Join(ev.AccessNodes, ",")
+        }
+        out = append(out, statement{
+            key: "EV_ " + ev.Name,
+            text: fmt.Sprintf("EV_ %s: %d [%g|%g] %s %g %d DUMMY_NODE_VECTOR%X %s;",
+                ev.Name, typ, ev.Minimum, ev.Maximum, quoteString(ev.Unit), ev.InitialValue, ev.ID, access, nodes),
+        })
     }
-    if len(f.AttrValues) > 0 {
-        file.WriteString("\n")
+    for _, ev := range f.EnvVars {
+        if ev.Type == EnvData {
+            out = append(out, statement{
+                key:  "ENVVAR_DATA_ " + ev.Name,
+                text: fmt.Sprintf("ENVVAR_DATA_ %s: %d;", ev.Name, ev.DataSize),
+            })
+        }
     }
+    return out
+}
 
-    // 5) Comments
+func renderComments(f *DBCFile) []statement {
+    var out []statement
     for _, c := range f.Comments {
         switch c.ObjectType {
-        case "BO_":
-            fmt.Fprintf(file, "CM_ BO_ %s \"%s\";\n",
-                c.ObjectName, c.Text)
-        case "SG_":
-            // ObjectName is "MsgID SigName"
-            parts := strings.SplitN(c.ObjectName, " ", 2)
-            if len(parts) == 2 {
-                fmt.Fprintf(file, "CM_ SG_ %s %s \"%s\";\n",
-                    parts[0], parts[1], c.Text)
-            }
-        case "BU_":
-            fmt.Fprintf(file, "CM_ BU_ %s \"%s\";\n",
-                c.ObjectName, c.Text)
+        case "BO_", "SG_", "BU_", "EV_":
+            // for SG_, ObjectName is "MsgID SigName"
+            out = append(out, statement{
+                key:  "CM_ " + c.ObjectType + " " + c.ObjectName,
+                text: fmt.Sprintf("CM_ %s %s %s;", c.ObjectType, c.ObjectName, quoteString(c.Text)),
+            })
         default:
-            fmt.Fprintf(file, "CM_ \"%s\";\n", c.Text)
+            out = append(out, statement{
+                key:  "CM_",
+                text: fmt.Sprintf("CM_ %s;", quoteString(c.Text)),
+            })
+        }
+    }
+    return out
+}
+
+// renderAttributeDefs writes every BA_DEF_, e.g.
+//   BA_DEF_ BO_ "GenMsgCycleTime" INT 0 65535;
+//   BA_DEF_ SG_ "GenSigSendType" ENUM "Cyclic","OnWrite";
+func renderAttributeDefs(f *DBCFile) []statement {
+    var defs []statement
+    attrDefs, _ := f.frameFormatAttributes()
+    for _, def := range attrDefs {
+        var typ string
+        switch def.DataType {
+        case AttrInt, AttrHex:
+            kw := "INT"
+            if def.DataType == AttrHex {
+                kw = "HEX"
+            }
+            // plain decimal, never an exponent, so large bounds stay exact
+            typ = kw + " " + strconv.FormatFloat(def.Minimum, 'f', -1, 64) + " " +
+                strconv.FormatFloat(def.Maximum, 'f', -1, 64)
+        case AttrFloat:
+            typ = fmt.Sprintf("FLOAT %g %g", def.Minimum, def.Maximum)
+        case AttrString:
+            typ = "STRING "
+        case AttrEnum:
+            labels := make([]string, len(def.EnumValues))
+            for i, v := range def.EnumValues {
+                labels[i] = quoteString(v)
+            }
+            typ = "ENUM " + strings.Join(labels, ",")
+        }
+        // DBC allows a single object type per definition, so one is written
+        // per type; none means network
+        scopes := def.AppliesTo
+        if len(scopes) == 0 {
+            scopes = []string{""}
+        }
+        for _, scope := range scopes {
+            if scope != "" {
+                scope += " "
+            }
+            defs = append(defs, statement{
+                key:  "BA_DEF_ " + def.Name,
+                text: fmt.Sprintf("BA_DEF_ %s%s %s;", scope, quoteString(def.Name), typ),
+            })
         }
     }
-    if len(f.Comments) > 0 {
-        file.WriteString("\n")
+    return defs
+}
+
+// renderAttributeDefaults writes the BA_DEF_DEF_ defaults, e.g.
+//   BA_DEF_DEF_ "GenMsgCycleTime" 100;
+func renderAttributeDefaults(f *DBCFile) []statement {
+    var defaults []statement
+    attrDefs, _ := f.frameFormatAttributes()
+    for _, def := range attrDefs {
+        if def.DefaultValue != "" {
+            // STRING and ENUM defaults are always quoted, ENUM by label
+            value := formatAttribute(&def, def.DefaultValue)
+            if def.DataType == AttrEnum {
+                label := def.DefaultValue
+                if !contains(def.EnumValues, label) {
+                    label = def.enumLabel(label)
+                }
+                value = quoteString(label)
+            }
+            defaults = append(defaults, statement{
+                key:  "BA_DEF_DEF_ " + def.Name,
+                text: fmt.Sprintf("BA_DEF_DEF_ %s %s;", quoteString(def.Name), value),
+            })
+        }
     }
+    return defaults
+}
 
-    // 6) Messages + Signals
+func renderAttributeValues(f *DBCFile) []statement {
+    var out []statement
+    _, attrValues := f.frameFormatAttributes()
+    for _, av := range attrValues {
+        // ObjectName is "MsgID SigName" for SG_, so it can follow the type as-is
+        object := ""
+        if av.ObjectType != "" {
+            object = av.ObjectType + " " + av.ObjectName + " "
+        }
+        out = append(out, statement{
+            key:  strings.TrimSpace("BA_ " + av.AttrName + " " + object),
+            text: fmt.Sprintf("BA_ %s %s%s;", quoteString(av.AttrName), object, f.formatAttributeValue(av.AttrName, av.Value)),
+        })
+    }
+    return out
+}
+
+func renderValueDescriptions(f *DBCFile) []statement {
+    var out []statement
     for _, msg := range f.Messages {
-        tx := strings.Join(msg.Transmitters, ",")
-        fmt.Fprintf(file, "BO_ %d %s: %d %s\n",
-            msg.ID, msg.Name, msg.DLC, tx)
         for _, sig := range msg.Signals {
-            // mux
-            mux := ""
-            switch sig.MuxType {
-            case MuxSwitch:
-                mux = " M"
-            case MuxSignal:
-                mux = fmt.Sprintf(" m%d", sig.MuxValue)
+            if len(sig.ValueDescriptions) == 0 {
+                continue
             }
-            end := "0"
-            if sig.Endianness == LittleEndian {
-                end = "1"
+            out = append(out, statement{
+                key:  fmt.Sprintf("VAL_ %d %s", msg.RawID(), sig.Name),
+                text: fmt.Sprintf("VAL_ %d %s %s ;", msg.RawID(), sig.Name, formatValuePairs(sig.ValueDescriptions)),
+            })
+        }
+    }
+    for _, ev := range f.EnvVars {
+        if len(ev.ValueDescriptions) == 0 {
+            continue
+        }
+        out = append(out, statement{
+            key:  "VAL_ " + ev.Name,
+            text: fmt.Sprintf("VAL_ %s %s ;", ev.Name, formatValuePairs(ev.ValueDescriptions)),
+        })
+    }
+    return out
+}
+
+func renderSignalValueTypes(f *DBCFile) []statement {
+    var out []statement
+    for _, msg := range f.Messages {
+        for _, sig := range msg.Signals {
+            if sig.ValueType == ValueInteger {
+                continue
             }
-            sign := "+"
-            if sig.IsSigned {
-                sign = "-"
+            out = append(out, statement{
+                key:  fmt.Sprintf("SIG_VALTYPE_ %d %s", msg.RawID(), sig.Name),
+                text: fmt.Sprintf("SIG_VALTYPE_ %d %s : %d;", msg.RawID(), sig.Name, sig.ValueType),
+            })
+        }
+    }
+    return out
+}
+
+func renderSignalGroups(f *DBCFile) []statement {
+    var out []statement
+    for _, msg := range f.Messages {
+        for _, g := range msg.SignalGroups {
+            out = append(out, statement{
+                key: fmt.Sprintf("SIG_GROUP_ %d %s", msg.RawID(), g.Name),
+                text: fmt.Sprintf("SIG_GROUP_ %d %s %d : %s;",
+                    msg.RawID(), g.Name, g.Repetitions, strings.Join(g.Signals, " ")),
+            })
+        }
+    }
+    return out
+}
+
+func renderExtendedMux(f *DBCFile) []statement {
+    var out []statement
+    for _, msg := range f.Messages {
+        for _, sig := range msg.Signals {
+            if sig.MuxSwitchName == "" || len(sig.MuxRanges) == 0 {
+                continue
+            }
+            ranges := make([]string, len(sig.MuxRanges))
+            for i, r := range sig.MuxRanges {
+                ranges[i] = fmt.Sprintf("%d-%d", r.Min, r.Max)
             }
-            rec := strings.Join(sig.Receivers, ",")
-            fmt.Fprintf(file, " SG_ %s%s : %d|%d@%s%s (%g,%g) [%g|%g] \"%s\" %s\n",
-                sig.Name, mux,
-                sig.StartBit, sig.Length, end, sign,
-                sig.Factor, sig.Offset,
-                sig.Minimum, sig.Maximum,
-                sig.Unit, rec)
+            out = append(out, statement{
+                key: fmt.Sprintf("SG_MUL_VAL_ %d %s", msg.RawID(), sig.Name),
+                text: fmt.Sprintf("SG_MUL_VAL_ %d %s %s %s;",
+                    msg.RawID(), sig.Name, sig.MuxSwitchName, strings.Join(ranges, ", ")),
+            })
         }
-        file.WriteString("\n")
     }
+    return out
+}
+
+// formatValuePairs renders VAL_ entries as `0 "Off" 1 "On"` in ascending order
+func formatValuePairs(values map[int]string) string {
+    keys := make([]int, 0, len(values))
+    for k := range values {
+        keys = append(keys, k)
+    }
+    sort.Ints(keys)
+    parts := make([]string, len(keys))
+    for i, k := range keys {
+        parts[i] = strconv.Itoa(k) + " " + quoteString(values[k])
+    }
+    return strings.Join(parts, " ")
+}
+
+// quoteString renders s as a DBC string literal, escaping quotes and
+// backslashes the way the lexer reads them back
+func quoteString(s string) string {
+    if !strings.ContainsAny(s, `\"`) {
+        return `"` + s + `"`
+    }
+    s = strings.ReplaceAll(s, `\`, `\\`)
+    s = strings.ReplaceAll(s, `"`, `\"`)
+    return `"` + s + `"`
+}
+
+// formatAttributeValue renders the value of attribute name for BA_
+func (f *DBCFile) formatAttributeValue(name, value string) string {
+    return formatAttribute(f.AttributeDef(name), value)
+}
 
-    return nil
+// formatAttribute renders an attribute value: STRING values and anything
+// that is not a number are quoted, numbers (including ENUM indices) are not
+func formatAttribute(def *AttributeDefinition, value string) string {
+    if def != nil && def.DataType == AttrString {
+        return quoteString(value)
+    }
+    if _, err := strconv.ParseFloat(value, 64); err != nil {
+        return quoteString(value)
+    }
+    return value
 }
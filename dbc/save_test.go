@@ -0,0 +1,377 @@
+package dbc
+
+import (
+    "bytes"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+// nastyStrings are string contents the writer has to escape or keep intact
+var nastyStrings = []string{
+    "",
+    "plain",
+    `say "hi"`,
+    `C:\temp\`,
+    `\"`,
+    `"`,
+    `\\`,
+    "semi;colon, comma",
+    "two\nlines",
+    "BO_ 1 X: 8 Y",
+    "ümlaut °C",
+}
+
+// roundTrip saves f and parses the result back
+func roundTrip(t *testing.T, f *DBCFile) *DBCFile {
+    t.Helper()
+    var buf bytes.Buffer
+    if _, err := f.WriteTo(&buf); err != nil {
+        t.Fatalf("WriteTo: %v", err)
+    }
+    out, err := NewParser().Parse(bytes.NewReader(buf.Bytes()))
+    if err != nil {
+        t.Fatalf("Parse: %v\n%s", err, buf.String())
+    }
+    return out
+}
+
+func TestRoundTripStrings(t *testing.T) {
+    for _, s := range nastyStrings {
+        f := &DBCFile{
+            Version: s,
+            Nodes:   []Node{{Name: "ECU"}},
+            ValueTables: []ValueTable{
+                {Name: "Table", Values: map[int]string{0: s, 1: "x"}},
+            },
+            Messages: []Message{{
+                ID:           100,
+                Name:         "Msg",
+                DLC:          8,
+                Transmitters: []string{"ECU"},
+                Signals: []Signal{{
+                    Name:              "Sig",
+                    Length:            8,
+                    Factor:            1,
+                    Unit:              s,
+                    Receivers:         []string{"ECU"},
+                    ValueDescriptions: map[int]string{3: s},
+                }},
+            }},
+            EnvVars: []EnvironmentVariable{{Name: "Env", Unit: s}},
+            Comments: []Comment{
+                {ObjectType: "CM_", Text: s},
+                {ObjectType: "BO_", ObjectName: "100", Text: s},
+                {ObjectType: "SG_", ObjectName: "100 Sig", Text: s},
+            },
+            AttrValues: []AttributeValue{
+                {AttrName: "Note", Value: s},
+                {AttrName: "Note", ObjectType: "BU_", ObjectName: "ECU", Value: s},
+            },
+        }
+
+        got := roundTrip(t, f)
+        sig := got.Messages[0].Signals[0]
+        checks := []struct {
+            what, got string
+        }{
+            {"version", got.Version},
+            {"value table", got.ValueTables[0].Values[0]},
+            {"unit", sig.Unit},
+            {"value description", sig.ValueDescriptions[3]},
+            {"env var unit", got.EnvVars[0].Unit},
+            {"network comment", got.Comments[0].Text},
+            {"message comment", got.Comments[1].Text},
+            {"signal comment", got.Comments[2].Text},
+            {"network attribute", got.AttrValues[0].Value},
+            {"node attribute", got.AttrValues[1].Value},
+        }
+        for _, c := range checks {
+            if c.got != s {
+                t.Errorf("%s: got %q, want %q", c.what, c.got, s)
+            }
+        }
+    }
+}
+
+func TestQuoteString(t *testing.T) {
+    tests := []struct {
+        in, want string
+    }{
+        {"", `""`},
+        {"abc", `"abc"`},
+        {`a"b`, `"a\"b"`},
+        {`a\b`, `"a\\b"`},
+        {`\"`, `"\\\""`},
+    }
+    for _, tt := range tests {
+        if got := quoteString(tt.in); got != tt.want {
+            t.Errorf("quoteString(%q) = %s, want %s", tt.in, got, tt.want)
+        }
+    }
+}
+
+func TestRoundTripAttributeDefs(t *testing.T) {
+    f := &DBCFile{
+        Attributes: []AttributeDefinition{
+            {Name: "BusType", DataType: AttrString, DefaultValue: `CAN "FD"`},
+            {Name: "NodeAddress", DataType: AttrHex, AppliesTo: []string{"BU_"}, Maximum: 255, DefaultValue: "16"},
+            {Name: "GenMsgCycleTime", DataType: AttrInt, AppliesTo: []string{"BO_"}, Maximum: 65535, DefaultValue: "100"},
+            {Name: "GenSigStartValue", DataType: AttrFloat, AppliesTo: []string{"SG_"}, Minimum: -1.5, Maximum: 1e9},
+            {Name: "GenSigSendType", DataType: AttrEnum, AppliesTo: []string{"SG_"},
+                EnumValues: []string{"Cyclic", "On Write", `"Odd"`}, DefaultValue: "On Write"},
+        },
+    }
+    got := roundTrip(t, f)
+    clearAttributeSources(got)
+    if !reflect.DeepEqual(got.Attributes, f.Attributes) {
+        t.Errorf("attributes changed:\n got %+v\nwant %+v", got.Attributes, f.Attributes)
+    }
+}
+
+// exportSample is laid out like a CANdb++ export, including statements the
+// model keeps as RawSections
+const exportSample = `VERSION "1.0 \\ \"beta\""
+
+
+NS_ : 
+	NS_DESC_
+	CM_
+	BA_DEF_
+	BA_
+	VAL_
+	CAT_DEF_
+	CAT_
+	BA_DEF_DEF_
+	SGTYPE_
+	VAL_TABLE_
+	SIG_GROUP_
+	SIG_VALTYPE_
+	BO_TX_BU_
+	BA_DEF_REL_
+	BA_REL_
+	BA_DEF_DEF_REL_
+	BU_SG_REL_
+	SG_MUL_VAL_
+
+BS_:
+
+BU_: Engine Gateway Dash
+
+VAL_TABLE_ OnOff 1 "On" 0 "Off" ;
+
+
+BO_ 256 EngineData: 8 Engine
+ SG_ Speed : 0|16@1+ (0.25,0) [0|16383.75] "rpm" Gateway,Dash
+ SG_ Temp : 23|8@0- (1,-40) [-40|215] "\xb0C" Dash
+ SG_ Mode M : 24|4@1+ (1,0) [0|15] "" Dash
+ SG_ Pressure m1 : 32|16@1+ (0.1,0) [0|6553.5] "kPa" Dash
+ SG_ Level m1M : 48|8@1+ (1,0) [0|255] "" Dash
+ SG_ Fuel : 56|8@1+ (0.5,0) [0|127.5] "%" Dash
+
+BO_ 2566844672 Ext: 8 Gateway
+ SG_ Ratio : 0|32@1- (1,0) [0|0] "" Dash
+
+BO_TX_BU_ 256 : Engine,Gateway;
+
+SGTYPE_ TempType : 8@0- (1,-40) [-40|215] "degC" 0 OnOff;
+
+CM_ "Network for \"unit\" tests; with C:\\path";
+CM_ BU_ Engine "Engine ECU";
+CM_ BO_ 256 "Engine data;
+second line";
+CM_ SG_ 256 Speed "Engine speed";
+BA_DEF_ "DBName" STRING ;
+BA_DEF_ BO_ "GenMsgCycleTime" INT 0 10000;
+BA_DEF_ SG_ "GenSigSendType" ENUM  "Cyclic","OnWrite","On \"Change\"";
+BA_DEF_REL_ BU_SG_REL_ "GenSigTimeoutTime" INT 0 65535;
+BA_DEF_DEF_ "DBName" "";
+BA_DEF_DEF_ "GenMsgCycleTime" 0;
+BA_DEF_DEF_ "GenSigSendType" "Cyclic";
+BA_DEF_DEF_REL_ "GenSigTimeoutTime" 0;
+BA_ "DBName" "Engine \"CAN\"";
+BA_ "GenMsgCycleTime" BO_ 256 100;
+BA_ "GenSigSendType" SG_ 256 Speed 2;
+BA_REL_ "GenSigTimeoutTime" BU_SG_REL_ Dash SG_ 256 Speed 500;
+CAT_DEF_ 1 "Powertrain" 0;
+CAT_ BU_ Engine 1;
+VAL_ 256 Mode 0 "Idle" 1 "Run" ;
+SIG_GROUP_ 256 Core 1 : Speed Temp;
+SIG_VALTYPE_ 2566844672 Ratio : 1;
+SG_MUL_VAL_ 256 Pressure Level 1-1;
+BU_SG_REL_ Dash SG_ 256 Speed ;
+`
+
+// clearSources drops everything that depends on where objects were in
+// the file, so models parsed from different layouts can be compared
+func clearSources(f *DBCFile) {
+    f.source = nil
+    f.BitTimingSource = SourceSpan{}
+    for i := range f.Nodes {
+        f.Nodes[i].Source = SourceSpan{}
+    }
+    for i := range f.ValueTables {
+        f.ValueTables[i].Source = SourceSpan{}
+    }
+    for i := range f.Messages {
+        m := &f.Messages[i]
+        m.Source, m.TransmittersSource = SourceSpan{}, SourceSpan{}
+        for j := range m.Signals {
+            s := &m.Signals[j]
+            s.Source, s.ValueDescriptionsSource = SourceSpan{}, SourceSpan{}
+            s.ValueTypeSource, s.MuxSource = SourceSpan{}, SourceSpan{}
+        }
+        for j := range m.SignalGroups {
+            m.SignalGroups[j].Source = SourceSpan{}
+        }
+    }
+    for i := range f.EnvVars {
+        ev := &f.EnvVars[i]
+        ev.Source, ev.DataSizeSource, ev.ValueDescriptionsSource = SourceSpan{}, SourceSpan{}, SourceSpan{}
+    }
+    for i := range f.Comments {
+        f.Comments[i].Source = SourceSpan{}
+    }
+    for i := range f.RawSections {
+        f.RawSections[i].Source = SourceSpan{}
+    }
+    clearAttributeSources(f)
+}
+
+func TestRoundTripExport(t *testing.T) {
+    f := mustParse(t, exportSample)
+    var first, second bytes.Buffer
+    if _, err := f.WriteTo(&first); err != nil {
+        t.Fatal(err)
+    }
+    got, err := NewParser().Parse(bytes.NewReader(first.Bytes()))
+    if err != nil {
+        t.Fatalf("%v\n%s", err, first.String())
+    }
+    if _, err := got.WriteTo(&second); err != nil {
+        t.Fatal(err)
+    }
+
+    clearSources(f)
+    clearSources(got)
+    if !reflect.DeepEqual(got, f) {
+        t.Errorf("model changed:\n got %+v\nwant %+v", got, f)
+    }
+    if first.String() != second.String() {
+        t.Errorf("second save differs:\n%s\n---\n%s", first.String(), second.String())
+    }
+
+    // raw statements come back verbatim, after the section they followed
+    for _, raw := range []string{
+        `SGTYPE_ TempType : 8@0- (1,-40) [-40|215] "degC" 0 OnOff;`,
+        `BA_DEF_REL_ BU_SG_REL_ "GenSigTimeoutTime" INT 0 65535;`,
+        `BA_REL_ "GenSigTimeoutTime" BU_SG_REL_ Dash SG_ 256 Speed 500;`,
+        `CAT_DEF_ 1 "Powertrain" 0;`,
+        `BU_SG_REL_ Dash SG_ 256 Speed ;`,
+    } {
+        if !strings.Contains(first.String(), "\n"+raw+"\n") {
+            t.Errorf("output lacks %q:\n%s", raw, first.String())
+        }
+    }
+    if len(f.RawSections) != 7 {
+        t.Errorf("got %d raw sections, want 7: %+v", len(f.RawSections), f.RawSections)
+    }
+
+    // quoting of names and string values
+    for _, quoted := range []string{
+        `VERSION "1.0 \\ \"beta\""`,
+        `BA_DEF_ SG_ "GenSigSendType" ENUM "Cyclic","OnWrite","On \"Change\"";`,
+        `BA_ "DBName" "Engine \"CAN\"";`,
+        `CM_ "Network for \"unit\" tests; with C:\\path";`,
+    } {
+        if !strings.Contains(first.String(), quoted) {
+            t.Errorf("output lacks %s:\n%s", quoted, first.String())
+        }
+    }
+}
+
+func TestSaveFailureKeepsOriginal(t *testing.T) {
+    dir := t.TempDir()
+    path := filepath.Join(dir, "bus.dbc")
+    // large enough that the temporary file receives data before the error
+    f := mustParse(t, string(syntheticDBC(200, true)))
+    if err := f.Save(path); err != nil {
+        t.Fatal(err)
+    }
+    original, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // the comment cannot be encoded, so writing fails after the messages
+    // have gone out
+    f.Comments = append(f.Comments, Comment{ObjectType: "CM_", Text: "Ω"})
+    if err := f.SaveWithOptions(path, SaveOptions{Encoding: EncodingCP1252}); err == nil {
+        t.Fatal("save of an unencodable comment succeeded")
+    }
+    if got, err := os.ReadFile(path); err != nil || !bytes.Equal(got, original) {
+        t.Errorf("original changed by a failed save (err %v)", err)
+    }
+    entries, err := os.ReadDir(dir)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(entries) != 1 {
+        t.Errorf("temporary files left behind: %v", entries)
+    }
+
+    // a later save still goes through
+    f.Comments = f.Comments[:len(f.Comments)-1]
+    f.Version = "2.0"
+    if err := f.Save(path); err != nil {
+        t.Fatal(err)
+    }
+    if got, _ := os.ReadFile(path); !bytes.Contains(got, []byte(`VERSION "2.0"`)) {
+        t.Errorf("second save not written:\n%s", got)
+    }
+}
+
+func TestAttributeDefScopesAndBounds(t *testing.T) {
+    f := &DBCFile{
+        Attributes: []AttributeDefinition{
+            {Name: "Owner", DataType: AttrString, AppliesTo: []string{"BU_", "BO_", "SG_"}},
+            {Name: "Mask", DataType: AttrHex, AppliesTo: []string{"BO_"}, Maximum: 4294967295},
+            {Name: "Wide", DataType: AttrInt, AppliesTo: []string{"SG_"}, Minimum: -9007199254740992, Maximum: 9007199254740992},
+        },
+    }
+    var buf bytes.Buffer
+    if _, err := f.WriteTo(&buf); err != nil {
+        t.Fatal(err)
+    }
+    for _, line := range []string{
+        `BA_DEF_ BU_ "Owner" STRING ;`,
+        `BA_DEF_ BO_ "Owner" STRING ;`,
+        `BA_DEF_ SG_ "Owner" STRING ;`,
+        `BA_DEF_ BO_ "Mask" HEX 0 4294967295;`,
+        `BA_DEF_ SG_ "Wide" INT -9007199254740992 9007199254740992;`,
+    } {
+        if !strings.Contains(buf.String(), line+"\n") {
+            t.Errorf("output lacks %q:\n%s", line, buf.String())
+        }
+    }
+
+    got := roundTrip(t, f)
+    clearAttributeSources(got)
+    if !reflect.DeepEqual(got.Attributes, f.Attributes) {
+        t.Errorf("attributes changed:\n got %+v\nwant %+v", got.Attributes, f.Attributes)
+    }
+
+    // both scopes survive a preserving save untouched
+    src := "BA_DEF_ BU_  \"Owner\" STRING ;\nBA_DEF_ BO_  \"Owner\" STRING ;\n"
+    if out := savePreserving(t, parseForEdit(t, src)); out != src {
+        t.Errorf("preserving save changed the definitions:\n%s", out)
+    }
+
+    // a redefinition with another type is kept apart
+    conflict := mustParse(t, "BA_DEF_ BU_ \"X\" STRING ;\nBA_DEF_ BO_ \"X\" INT 0 1;\n")
+    if len(conflict.Attributes) != 2 {
+        t.Errorf("conflicting definitions merged: %+v", conflict.Attributes)
+    }
+}
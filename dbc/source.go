@@ -0,0 +1,258 @@
+package dbc
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+)
+
+// sourceSpan ties the lines of one parsed statement to the key of the
+// model object it produced
+type sourceSpan struct {
+    key         string
+    first, last int // 0-based line indexes, inclusive
+}
+
+// sourceText is the original file a DBCFile was parsed from
+type sourceText struct {
+    lines []string
+    crlf  bool
+    opts  ParseOptions // what the file was parsed with
+    spans []sourceSpan // only while a preserving save parses lines again
+}
+
+// scanRawLines is bufio.ScanLines without the "\r" stripping, so the
+// parser can tell CRLF files apart
+func scanRawLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+    if atEOF && len(data) == 0 {
+        return 0, nil, nil
+    }
+    if i := bytes.IndexByte(data, '\n'); i >= 0 {
+        return i + 1, data[:i], nil
+    }
+    if atEOF {
+        return len(data), data, nil
+    }
+    return 0, nil, nil
+}
+
+// recordSpan files the statement just dispatched under its key
+func (p *Parser) recordSpan() {
+    spans := p.source.spans
+    if p.extendSpan && len(spans) > 0 {
+        spans[len(spans)-1].last = p.lineNo - 1
+        return
+    }
+    if p.spanKey == "" {
+        return
+    }
+    p.source.spans = append(spans, sourceSpan{
+        key:   p.spanKey,
+        first: p.stmtLine - 1,
+        last:  p.lineNo - 1,
+    })
+}
+
+// parsed parses the lines again and returns the model as it was loaded,
+// with the span of every statement. Working both out on save rather than
+// on load keeps loading fast.
+func (src *sourceText) parsed() (*DBCFile, []sourceSpan, error) {
+    opts := src.opts
+    // lines are already UTF-8
+    opts.KeepSource, opts.Encoding = false, EncodingUTF8
+    p := NewParserWithOptions(opts)
+    p.recordSpans = true
+    f, err := p.Parse(strings.NewReader(strings.Join(src.lines, "\n")))
+    if err != nil {
+        return nil, nil, err
+    }
+
+    spans := p.source.spans
+    keys := make([]statement, len(spans))
+    for i, sp := range spans {
+        keys[i].key = sp.key
+    }
+    uniqueKeys(keys)
+    for i := range spans {
+        spans[i].key = keys[i].key
+    }
+    return f, spans, nil
+}
+
+// statementKey identifies the model object a parsed statement describes,
+// using the same keys the writer gives its statements
+func (p *Parser) statementKey(keyword, stmt string) string {
+    // the key never needs more than the first few tokens; VAL_ and BA_
+    // statements can be very long
+    var buf [5]token
+    toks := headTokens(buf[:], stmt)
+    arg := func(i int) string {
+        if i < len(toks) {
+            return toks[i].text
+        }
+        return ""
+    }
+    // object types are keywords; a quoted "BO_" is a comment or value
+    ident := func(i int) string {
+        if i < len(toks) && toks[i].kind == tokIdent {
+            return toks[i].text
+        }
+        return ""
+    }
+
+    switch keyword {
+    case "SG_":
+        if len(p.file.Messages) == 0 {
+            return keyword
+        }
+        id := p.file.Messages[len(p.file.Messages)-1].RawID()
+        return "SG_ " + strconv.FormatUint(uint64(id), 10) + " " + arg(1)
+    case "BO_", "BO_TX_BU_", "EV_", "ENVVAR_DATA_", "VAL_TABLE_", "BA_DEF_DEF_":
+        return keyword + " " + arg(1)
+    case "SIG_VALTYPE_", "SIG_GROUP_", "SG_MUL_VAL_":
+        return keyword + " " + arg(1) + " " + arg(2)
+    case "VAL_":
+        if len(toks) > 1 && toks[1].kind == tokNumber {
+            return keyword + " " + arg(1) + " " + arg(2)
+        }
+        return keyword + " " + arg(1)
+    case "CM_":
+        switch ident(1) {
+        case "BU_", "BO_", "EV_":
+            return "CM_ " + arg(1) + " " + arg(2)
+        case "SG_":
+            return "CM_ SG_ " + arg(2) + " " + arg(3)
+        }
+        return keyword
+    case "BA_DEF_":
+        for _, t := range toks {
+            if t.kind == tokString {
+                return keyword + " " + t.text
+            }
+        }
+        return keyword
+    case "BA_":
+        switch ident(2) {
+        case "BU_", "BO_", "EV_":
+            return "BA_ " + arg(1) + " " + arg(2) + " " + arg(3)
+        case "SG_":
+            return "BA_ " + arg(1) + " SG_ " + arg(3) + " " + arg(4)
+        }
+        return "BA_ " + arg(1)
+    }
+    return keyword
+}
+
+// rawKey is the statement key of f.RawSections[i]
+func rawKey(i int) string {
+    return fmt.Sprintf("RAW %d", i)
+}
+
+// uniqueKeys suffixes repeated keys (e.g. several network CM_) with their
+// occurrence count so every statement can be matched one-to-one
+func uniqueKeys(stmts []statement) {
+    seen := make(map[string]int, len(stmts))
+    for i, st := range stmts {
+        seen[st.key]++
+        if n := seen[st.key]; n > 1 {
+            stmts[i].key = st.key + "#" + strconv.Itoa(n)
+        }
+    }
+}
+
+// writePreserving writes the original text with only the edited statements
+// replaced. Statements that no longer exist are dropped, new ones are
+// inserted after the statement that precedes them in canonical order, and
+// statements the writer does not produce are kept verbatim.
+// Statements the writer adds by default are only inserted once edited.
+func (f *DBCFile) writePreserving(w io.Writer) (int64, error) {
+    src := f.source
+    orig, spans, err := src.parsed()
+    if err != nil {
+        return 0, fmt.Errorf("parsing the original text again: %w", err)
+    }
+    // statement text per key as parsed
+    parsedText := map[string]string{}
+    for _, st := range orig.statements() {
+        parsedText[st.key] = st.text
+    }
+    current := f.statements()
+
+    inSource := map[string]bool{}
+    for _, sp := range spans {
+        inSource[sp.key] = true
+    }
+    currentByKey := map[string]statement{}
+    insertAfter := map[string][]statement{}
+    var leading []statement
+    anchor := ""
+    for _, st := range current {
+        currentByKey[st.key] = st
+        switch {
+        case !inSource[st.key] && parsedText[st.key] == st.text:
+            // written by default (e.g. an empty BS_:) but absent from the source
+        case inSource[st.key]:
+            anchor = st.key
+        case anchor == "":
+            leading = append(leading, st)
+        default:
+            insertAfter[anchor] = append(insertAfter[anchor], st)
+        }
+    }
+
+    var out []string
+    lastBlank := func() bool { return len(out) == 0 || strings.TrimSpace(out[len(out)-1]) == "" }
+    emit := func(stmts []statement) {
+        for _, st := range stmts {
+            if st.gap && !lastBlank() {
+                out = append(out, "")
+            }
+            out = append(out, strings.Split(st.text, "\n")...)
+        }
+    }
+
+    spanAt := map[int]sourceSpan{}
+    for _, sp := range spans {
+        spanAt[sp.first] = sp
+    }
+    emit(leading)
+    afterDeleted := false
+    for i := 0; i < len(src.lines); {
+        sp, ok := spanAt[i]
+        if !ok {
+            // blank lines and anything outside a statement
+            blank := strings.TrimSpace(src.lines[i]) == ""
+            if !(blank && afterDeleted && lastBlank()) {
+                out = append(out, src.lines[i])
+            }
+            afterDeleted = afterDeleted && blank
+            i++
+            continue
+        }
+        old, rendered := parsedText[sp.key]
+        cur, exists := currentByKey[sp.key]
+        switch {
+        case !rendered, exists && cur.text == old:
+            out = append(out, src.lines[sp.first:sp.last+1]...)
+        case exists:
+            out = append(out, strings.Split(cur.text, "\n")...)
+        default:
+            // deleted; its lines are skipped
+        }
+        afterDeleted = rendered && !exists
+        i = sp.last + 1
+        emit(insertAfter[sp.key])
+    }
+
+    nl := "\n"
+    if src.crlf {
+        nl = "\r\n"
+    }
+    lw := &lineWriter{w: w}
+    for _, line := range out {
+        lw.line(line, nl)
+    }
+    return lw.n, lw.err
+}
@@ -0,0 +1,189 @@
+package dbc
+
+import (
+    "bytes"
+    "io"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+// handWritten is formatted the way no writer would produce it, so any
+// statement the preserving writer re-renders shows up in a diff
+const handWritten = `VERSION "hand written"
+
+
+NS_ :
+    CM_
+    BA_DEF_
+    BA_
+
+BS_:
+
+BU_:  ECU1   ECU2
+
+BO_ 100 First: 8 ECU1
+   SG_ A : 0|8@1+ (1,0) [0|255] ""  ECU2
+   SG_ B : 8|8@1+ (0.5,0) [0|127.5] "%"  ECU2
+
+BO_ 200 Second: 8 ECU2
+   SG_ C : 0|16@1+ (1,0) [0|65535] "" ECU1
+
+CM_ "first network comment";
+CM_   "second network comment";
+CM_ SG_ 100 A   "signal A";
+BA_DEF_  BO_ "GenMsgCycleTime" INT 0 10000;
+BA_DEF_DEF_  "GenMsgCycleTime" 0;
+BA_ "GenMsgCycleTime" BO_ 100   10;
+`
+
+// parseForEdit parses src the way the editor does before a preserving save
+func parseForEdit(t *testing.T, src string) *DBCFile {
+    t.Helper()
+    f, err := NewParserWithOptions(ParseOptions{Lenient: true, KeepSource: true}).Parse(strings.NewReader(src))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return f
+}
+
+// savePreserving returns what a preserving save of f writes
+func savePreserving(t *testing.T, f *DBCFile) string {
+    t.Helper()
+    var buf bytes.Buffer
+    if _, err := f.WriteWithOptions(&buf, SaveOptions{PreserveFormatting: true}); err != nil {
+        t.Fatal(err)
+    }
+    return buf.String()
+}
+
+// changedLines lists the lines of want and got that differ, assuming
+// neither gained or lost lines
+func changedLines(t *testing.T, want, got string) []string {
+    t.Helper()
+    w, g := strings.Split(want, "\n"), strings.Split(got, "\n")
+    if len(w) != len(g) {
+        t.Fatalf("line count changed from %d to %d:\n%s", len(w), len(g), got)
+    }
+    var diff []string
+    for i := range w {
+        if w[i] != g[i] {
+            diff = append(diff, g[i])
+        }
+    }
+    return diff
+}
+
+func TestWritePreservingUnchanged(t *testing.T) {
+    crlf := strings.ReplaceAll(handWritten, "\n", "\r\n")
+    lenient := handWritten + "BO_ x Broken: 8 ECU1\nVAL_ 300 Missing 0 \"Off\" ;\n"
+    for name, src := range map[string]string{"LF": handWritten, "CRLF": crlf, "skipped statements": lenient} {
+        f := parseForEdit(t, src)
+        if got := savePreserving(t, f); got != src {
+            t.Errorf("%s: output differs:\n%q\nwant\n%q", name, got, src)
+        }
+    }
+}
+
+func TestWritePreservingEdits(t *testing.T) {
+    t.Run("signal", func(t *testing.T) {
+        f := parseForEdit(t, handWritten)
+        f.MessageByID(100).SignalByName("B").Factor = 0.25
+        want := []string{` SG_ B : 8|8@1+ (0.25,0) [0|127.5] "%" ECU2`}
+        if got := changedLines(t, handWritten, savePreserving(t, f)); !reflect.DeepEqual(got, want) {
+            t.Errorf("changed %q, want %q", got, want)
+        }
+    })
+
+    t.Run("duplicate network comments", func(t *testing.T) {
+        f := parseForEdit(t, handWritten)
+        f.Comments[1].Text = "edited"
+        want := []string{`CM_ "edited";`}
+        if got := changedLines(t, handWritten, savePreserving(t, f)); !reflect.DeepEqual(got, want) {
+            t.Errorf("changed %q, want %q", got, want)
+        }
+    })
+
+    t.Run("added message", func(t *testing.T) {
+        f := parseForEdit(t, handWritten)
+        f.Messages = append(f.Messages, Message{ID: 300, Name: "Third", DLC: 2, Transmitters: []string{"ECU1"},
+            Signals: []Signal{{Name: "D", Length: 16, Factor: 1, Receivers: []string{"ECU2"}}}})
+        got := savePreserving(t, f)
+        want := strings.Replace(handWritten,
+            "   SG_ C : 0|16@1+ (1,0) [0|65535] \"\" ECU1\n",
+            "   SG_ C : 0|16@1+ (1,0) [0|65535] \"\" ECU1\n\nBO_ 300 Third: 2 ECU1\n SG_ D : 0|16@1+ (1,0) [0|0] \"\" ECU2\n", 1)
+        if got != want {
+            t.Errorf("got\n%s\nwant\n%s", got, want)
+        }
+    })
+
+    t.Run("deleted message", func(t *testing.T) {
+        f := parseForEdit(t, handWritten)
+        f.Messages = f.Messages[1:]
+        f.Comments = f.Comments[:2]
+        f.AttrValues = nil
+        got := savePreserving(t, f)
+        want := strings.NewReplacer(
+            "BO_ 100 First: 8 ECU1\n   SG_ A : 0|8@1+ (1,0) [0|255] \"\"  ECU2\n   SG_ B : 8|8@1+ (0.5,0) [0|127.5] \"%\"  ECU2\n\n", "",
+            "CM_ SG_ 100 A   \"signal A\";\n", "",
+            "BA_ \"GenMsgCycleTime\" BO_ 100   10;\n", "",
+        ).Replace(handWritten)
+        if got != want {
+            t.Errorf("got\n%s\nwant\n%s", got, want)
+        }
+    })
+}
+
+func TestStatementKey(t *testing.T) {
+    p := &Parser{file: &DBCFile{Messages: []Message{{ID: 100}}}}
+    tests := []struct {
+        keyword, stmt, want string
+    }{
+        {"BO_", "BO_ 100 First: 8 ECU1", "BO_ 100"},
+        {"SG_", `SG_ A : 0|8@1+ (1,0) [0|255] "" ECU2`, "SG_ 100 A"},
+        {"VAL_", `VAL_ 100 A 0 "Off" ;`, "VAL_ 100 A"},
+        {"VAL_", `VAL_ Env 0 "Off" ;`, "VAL_ Env"},
+        {"CM_", `CM_ "network";`, "CM_"},
+        {"CM_", `CM_ "BO_";`, "CM_"},
+        {"CM_", `CM_ SG_ 100 A "signal";`, "CM_ SG_ 100 A"},
+        {"CM_", `CM_ BO_ 100 "message";`, "CM_ BO_ 100"},
+        {"BA_DEF_", `BA_DEF_ BO_ "GenMsgCycleTime" INT 0 10;`, "BA_DEF_ GenMsgCycleTime"},
+        {"BA_DEF_DEF_", `BA_DEF_DEF_ "GenMsgCycleTime" 0;`, `BA_DEF_DEF_ GenMsgCycleTime`},
+        {"BA_", `BA_ "BusType" "CAN";`, "BA_ BusType"},
+        {"BA_", `BA_ "GenMsgCycleTime" BO_ 100 10;`, "BA_ GenMsgCycleTime BO_ 100"},
+        {"BA_", `BA_ "GenSigStartValue" SG_ 100 A 1;`, "BA_ GenSigStartValue SG_ 100 A"},
+        {"SG_MUL_VAL_", `SG_MUL_VAL_ 100 A Mode 1-1;`, "SG_MUL_VAL_ 100 A"},
+    }
+    for _, tt := range tests {
+        if got := p.statementKey(tt.keyword, tt.stmt); got != tt.want {
+            t.Errorf("statementKey(%q) = %q, want %q", tt.stmt, got, tt.want)
+        }
+    }
+}
+
+func TestUniqueKeys(t *testing.T) {
+    stmts := []statement{{key: "CM_"}, {key: "BO_ 1"}, {key: "CM_"}, {key: "CM_"}, {key: "BO_ 2"}}
+    uniqueKeys(stmts)
+    var got []string
+    for _, st := range stmts {
+        got = append(got, st.key)
+    }
+    want := []string{"CM_", "BO_ 1", "CM_#2", "CM_#3", "BO_ 2"}
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("got %q, want %q", got, want)
+    }
+}
+
+func TestSourceNotKeptByDefault(t *testing.T) {
+    f, err := NewParserWithOptions(ParseOptions{Lenient: true}).Parse(strings.NewReader(handWritten))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if f.source != nil {
+        t.Fatal("source kept without KeepSource")
+    }
+    // so a preserving save has nothing to preserve
+    if _, err := f.WriteWithOptions(io.Discard, SaveOptions{PreserveFormatting: true}); err == nil {
+        t.Error("preserving save without the source did not fail")
+    }
+}
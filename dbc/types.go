@@ -1,6 +1,9 @@
 package dbc
 
-import "time"
+import (
+    "fmt"
+    "time"
+)
 
 // Endianness for signal bit-packing
 type Endianness int
@@ -17,6 +20,22 @@ const (
     NoMux MultiplexerType = iota
     MuxSwitch    // this signal selects which muxed signals are active
     MuxSignal    // this is one of the signals under a mux
+    MuxSignalSwitch // muxed signal that is itself a switch ("m1M"), for nested multiplexing
+)
+
+// MuxValueRange is an inclusive range of switch values from SG_MUL_VAL_
+type MuxValueRange struct {
+    Min int `json:"min"`
+    Max int `json:"max"`
+}
+
+// SignalValueType is how a signal's raw bits are interpreted (SIG_VALTYPE_)
+type SignalValueType int
+
+const (
+    ValueInteger SignalValueType = iota // signed or unsigned integer, see IsSigned
+    ValueFloat   // IEEE 754 single precision, must be 32 bits
+    ValueDouble  // IEEE 754 double precision, must be 64 bits
 )
 
 // AttributeDataType indicates the kind of an attribute definition
@@ -27,6 +46,7 @@ const (
     AttrFloat
     AttrString
     AttrEnum
+    AttrHex
 )
 
 // DBCFile is the root object for a parsed .dbc
@@ -39,12 +59,15 @@ type DBCFile struct {
     FileName   string    `json:"filename"`
 
     // Symbol tables
+    NewSymbols  []string     `json:"new_symbols"` // keywords declared in the NS_ block
     Nodes       []Node       `json:"nodes"`
     BaudRates   []BaudRate   `json:"baud_rates"`
+    BitTimingSource SourceSpan `json:"bit_timing_source"` // the BS_ statement
     ValueTables []ValueTable `json:"value_tables"`
                              
     // Core data
     Messages   []Message             `json:"messages"`
+    EnvVars    []EnvironmentVariable `json:"env_vars"`
     Attributes []AttributeDefinition `json:"attributes"`
     AttrValues []AttributeValue      `json:"attr_values"`
 
@@ -53,11 +76,46 @@ type DBCFile struct {
 
     // Unknown or unsupported sections can be captured raw if needed
     RawSections []RawSection `json:"raw_sections"`
+
+    // character encoding the file was read in and is saved in by default
+    Encoding Encoding `json:"encoding"`
+
+    // problems a lenient parse skipped over
+    Diagnostics []Diagnostic `json:"diagnostics"`
+
+    // original text, for SaveOptions.PreserveFormatting; nil unless parsed
+    // with ParseOptions.KeepSource
+    source *sourceText
+}
+
+// SourceSpan locates the statement an object was parsed from. Lines and
+// columns are 1-based and inclusive; the zero value means the object was
+// not parsed (e.g. added in the editor).
+type SourceSpan struct {
+    File      string `json:"file"`
+    Line      int    `json:"line"`
+    Column    int    `json:"column"`
+    EndLine   int    `json:"end_line"`
+    EndColumn int    `json:"end_column"`
+}
+
+// IsValid reports whether the span points into a file
+func (s SourceSpan) IsValid() bool {
+    return s.Line > 0
+}
+
+// String formats the start of the span as "file:line:col"
+func (s SourceSpan) String() string {
+    if s.File == "" {
+        return fmt.Sprintf("%d:%d", s.Line, s.Column)
+    }
+    return fmt.Sprintf("%s:%d:%d", s.File, s.Line, s.Column)
 }
 
 // Node is a CAN node/transmitter
 type Node struct {
-    Name string `json:"name"`
+    Name   string     `json:"name"`
+    Source SourceSpan `json:"source"` // the name on the BU_ line
 }
 
 // BaudRate declaration
@@ -69,43 +127,121 @@ type BaudRate struct {
 type ValueTable struct {
     Name   string         `json:"name"`
     Values map[int]string `json:"values"`
+    Source SourceSpan     `json:"source"`
 }
 
 // Message represents a CAN frame definition
 type Message struct {
-    ID           uint32   `json:"id"`// CAN ID
-    Name         string   `json:"name"`
-    DLC          int      `json:"dlc"` // Data Length Code (0–8)
-    Transmitters []string `json:"transmitters"`   // Node names
-    Signals      []Signal `json:"signals"`
-    Comment      string   `json:"comment"` // optional
+    ID           uint32        `json:"id"` // CAN ID (11-bit, or 29-bit if IsExtended)
+    IsExtended   bool          `json:"is_extended"` // extended frame; bit 31 of the BO_ ID in the file
+    Name         string        `json:"name"`
+    DLC          int           `json:"dlc"` // payload length in bytes (0–8, CAN FD up to 64)
+    IsFD         bool          `json:"is_fd"` // CAN FD frame, from the VFrameFormat attribute
+    BRS          bool          `json:"brs"` // CAN FD bit rate switch, from the CANFD_BRS attribute
+    Transmitters []string      `json:"transmitters"` // Node names
+    Signals      []Signal      `json:"signals"`
+    SignalGroups []SignalGroup `json:"signal_groups"` // from SIG_GROUP_
+    Comment      string        `json:"comment"` // optional
+    Source       SourceSpan    `json:"source"` // the BO_ line
+    TransmittersSource SourceSpan `json:"transmitters_source"` // the BO_TX_BU_ statement, if any
+}
+
+// SignalGroup is a named set of signals of one message that are updated
+// together (AUTOSAR signal groups)
+type SignalGroup struct {
+    Name        string   `json:"name"`
+    Repetitions int      `json:"repetitions"`
+    Signals     []string   `json:"signals"` // member signal names
+    Source      SourceSpan `json:"source"`
+}
+
+// extendedIDFlag marks an extended (29-bit) frame in a BO_ ID
+const extendedIDFlag = 0x80000000
+
+// RawID returns the ID as written in the DBC file, with bit 31 set for
+// extended frames. Object references (BA_, CM_, VAL_ …) use this form.
+func (m *Message) RawID() uint32 {
+    if m.IsExtended {
+        return m.ID | extendedIDFlag
+    }
+    return m.ID
 }
 
 // Signal within a Message
 type Signal struct {
-    Name           string          `json:"name"`
-    StartBit       int             `json:"start_bit"`
-    Length         int             `json:"length"` 
-    Endianness     Endianness      `json:"endianness"`
-    IsSigned       bool            `json:"is_signed"`
-    Factor         float64         `json:"factor"` 
-    Offset         float64         `json:"offset"`
-    Minimum        float64         `json:"min"`
-    Maximum        float64         `json:"max"` 
-    Unit           string          `json:"unit"`
-    Receivers      []string        `json:"receivers"`
-    MuxType        MultiplexerType `json:"mux_type"`
-    MuxValue       int             `json:"mux_value"`    
-    Comment        string          `json:"comment"`
+    Name              string          `json:"name"`
+    StartBit          int             `json:"start_bit"`
+    Length            int             `json:"length"` 
+    Endianness        Endianness      `json:"endianness"`
+    IsSigned          bool            `json:"is_signed"`
+    ValueType         SignalValueType `json:"value_type"`
+    Factor            float64         `json:"factor"` 
+    Offset            float64         `json:"offset"`
+    Minimum           float64         `json:"min"`
+    Maximum           float64         `json:"max"` 
+    Unit              string          `json:"unit"`
+    Receivers         []string        `json:"receivers"`
+    MuxType           MultiplexerType `json:"mux_type"`
+    MuxValue          int             `json:"mux_value"`    
+    MuxSwitchName     string          `json:"mux_switch"` // extended multiplexing: the switch this signal depends on
+    MuxRanges         []MuxValueRange `json:"mux_ranges"` // extended multiplexing: switch values that activate this signal
+    Comment           string          `json:"comment"`
+    ValueDescriptions map[int]string  `json:"value_descriptions"` // from VAL_, e.g. 0 -> "Park"
+    Source            SourceSpan      `json:"source"` // the SG_ line
+    ValueDescriptionsSource SourceSpan `json:"value_descriptions_source"` // the VAL_ statement, if any
+    ValueTypeSource   SourceSpan      `json:"value_type_source"` // the SIG_VALTYPE_ statement, if any
+    MuxSource         SourceSpan      `json:"mux_source"` // the SG_MUL_VAL_ statement, if any
+}
+
+// EnvVarType is the value type of an environment variable
+type EnvVarType int
+
+const (
+    EnvInteger EnvVarType = iota
+    EnvFloat
+    EnvString
+    EnvData // declared with ENVVAR_DATA_, see DataSize
+)
+
+// EnvVarAccess restricts how nodes may use an environment variable
+type EnvVarAccess int
+
+const (
+    EnvUnrestricted EnvVarAccess = iota
+    EnvRead
+    EnvWrite
+    EnvReadWrite
+)
+
+// EnvironmentVariable is an EV_ declaration (used by HIL and simulation tools)
+type EnvironmentVariable struct {
+    Name              string         `json:"name"`
+    Type              EnvVarType     `json:"type"`
+    Minimum           float64        `json:"min"`
+    Maximum           float64        `json:"max"`
+    Unit              string         `json:"unit"`
+    InitialValue      float64        `json:"initial_value"`
+    ID                uint32         `json:"id"`
+    AccessType        EnvVarAccess   `json:"access_type"`
+    AccessNodes       []string       `json:"access_nodes"`
+    DataSize          int            `json:"data_size"` // bytes, from ENVVAR_DATA_
+    ValueDescriptions map[int]string `json:"value_descriptions"` // from VAL_
+    Source            SourceSpan     `json:"source"` // the EV_ statement
+    DataSizeSource    SourceSpan     `json:"data_size_source"` // the ENVVAR_DATA_ statement, if any
+    ValueDescriptionsSource SourceSpan `json:"value_descriptions_source"` // the VAL_ statement, if any
 }
 
 // AttributeDefinition defines a named attribute and where it can apply
 type AttributeDefinition struct {
     Name         string            `json:"name"` 
     DataType     AttributeDataType `json:"data_type"`
-    AppliesTo    []string          `json:"applies_to"` // eg "BU_", "BO_", "SG_"
+    AppliesTo    []string          `json:"applies_to"` // eg "BU_", "BO_", "SG_"; empty for network attributes
+    Minimum      float64           `json:"min"` // if DataType is AttrInt, AttrHex or AttrFloat
+    Maximum      float64           `json:"max"`
     DefaultValue string            `json:"default_value"`  // stored as string; cast based on DataType
     EnumValues   []string          `json:"enum_values"` // if DataType == AttrEnum
+    Source       SourceSpan        `json:"source"` // the BA_DEF_ statement
+    DefaultSource SourceSpan       `json:"default_source"` // the BA_DEF_DEF_ statement, if any
 }
 
 // AttributeValue assigns an attribute to an object
@@ -114,6 +250,7 @@ type AttributeValue struct {
     ObjectName string `json:"object_name"` // the name or ID of the object
     AttrName   string `json:"attr_name"` 
     Value      string `json:"value"`
+    Source     SourceSpan `json:"source"`
 }
 
 // Comment attaches free-form text to an object
@@ -121,10 +258,13 @@ type Comment struct {
     ObjectType string `json:"object_type"` // "BU_", "BO_", "SG_"
     ObjectName string `json:"object_name"`
     Text       string `json:"text"` 
+    Source     SourceSpan `json:"source"`
 }
 
 // RawSection holds unparsed or extra lines
 type RawSection struct {
     Keyword string   `json:"keyword"` // e.g. "BU_" or custom
+    After   string   `json:"after"`   // keyword of the parsed statement it followed, "" if none
     Lines   []string `json:"lines"`   // raw text lines
+    Source  SourceSpan `json:"source"`
 }
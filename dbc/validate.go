@@ -0,0 +1,114 @@
+package dbc
+
+import (
+    "errors"
+    "fmt"
+)
+
+// Validate checks the model for problems that would make the file
+// unusable on a bus, and returns all of them joined, or nil
+func (f *DBCFile) Validate() error {
+    return errors.Join(f.validate()...)
+}
+
+// ValidationDiagnostics returns the problems Validate finds as
+// Diagnostics with CodeInvalid, so they can be listed next to the ones
+// from parsing
+func (f *DBCFile) ValidationDiagnostics() []Diagnostic {
+    var out []Diagnostic
+    for _, err := range f.validate() {
+        d := Diagnostic{Severity: SeverityError, Code: CodeInvalid, Message: err.Error()}
+        var se *SourceError
+        if errors.As(err, &se) {
+            d.Line, d.Column, d.Message = se.Source.Line, se.Source.Column, se.Err.Error()
+        }
+        out = append(out, d)
+    }
+    return out
+}
+
+func (f *DBCFile) validate() []error {
+    var errs []error
+    for i := range f.Messages {
+        errs = append(errs, f.Messages[i].validate()...)
+    }
+    return errs
+}
+
+// SourceError is a problem with an object, located at the statement the
+// object was parsed from
+type SourceError struct {
+    Source SourceSpan
+    Err    error
+}
+
+func (e *SourceError) Error() string {
+    if !e.Source.IsValid() {
+        return e.Err.Error()
+    }
+    return e.Source.String() + ": " + e.Err.Error()
+}
+
+func (e *SourceError) Unwrap() error { return e.Err }
+
+// or returns s, or fallback if s does not point into a file
+func (s SourceSpan) or(fallback SourceSpan) SourceSpan {
+    if s.IsValid() {
+        return s
+    }
+    return fallback
+}
+
+func (m *Message) validate() []error {
+    var errs []error
+    if !ValidPayloadLength(m.PayloadSize(), m.IsFD) {
+        kind := "CAN"
+        if m.IsFD {
+            kind = "CAN FD"
+        }
+        errs = append(errs, &SourceError{m.Source, fmt.Errorf("message %s: %d bytes is not a valid %s payload length", m.Name, m.PayloadSize(), kind)})
+    }
+    bits := m.PayloadSize() * 8
+    for _, s := range m.Signals {
+        lo, hi := s.bitSpan()
+        if lo < 0 || hi >= bits {
+            errs = append(errs, &SourceError{s.Source, fmt.Errorf("message %s: signal %s (bits %d..%d) does not fit in %d-byte payload", m.Name, s.Name, lo, hi, m.PayloadSize())})
+        }
+        switch {
+        case s.ValueType == ValueFloat && s.Length != 32:
+            errs = append(errs, &SourceError{s.ValueTypeSource.or(s.Source), fmt.Errorf("message %s: float signal %s must be 32 bits, not %d", m.Name, s.Name, s.Length)})
+        case s.ValueType == ValueDouble && s.Length != 64:
+            errs = append(errs, &SourceError{s.ValueTypeSource.or(s.Source), fmt.Errorf("message %s: double signal %s must be 64 bits, not %d", m.Name, s.Name, s.Length)})
+        }
+        if s.MuxSwitchName != "" {
+            sw := m.SignalByName(s.MuxSwitchName)
+            if sw == nil || (sw.MuxType != MuxSwitch && sw.MuxType != MuxSignalSwitch) {
+                errs = append(errs, &SourceError{s.MuxSource.or(s.Source), fmt.Errorf("message %s: signal %s is multiplexed by %q, which is not a switch", m.Name, s.Name, s.MuxSwitchName)})
+            }
+        }
+        for _, r := range s.MuxRanges {
+            if r.Min > r.Max {
+                errs = append(errs, &SourceError{s.MuxSource.or(s.Source), fmt.Errorf("message %s: signal %s has empty mux range %d-%d", m.Name, s.Name, r.Min, r.Max)})
+            }
+        }
+    }
+    for _, g := range m.SignalGroups {
+        for _, name := range g.Signals {
+            if m.SignalByName(name) == nil {
+                errs = append(errs, &SourceError{g.Source, fmt.Errorf("message %s: signal group %s references unknown signal %q", m.Name, g.Name, name)})
+            }
+        }
+    }
+    return errs
+}
+
+// bitSpan returns the first and last bit the signal occupies, counted
+// linearly from bit 0 of byte 0. For big-endian (Motorola) signals the DBC
+// start bit is the MSB in sawtooth numbering.
+func (s *Signal) bitSpan() (int, int) {
+    if s.Endianness == LittleEndian {
+        return s.StartBit, s.StartBit + s.Length - 1
+    }
+    msb := (s.StartBit/8)*8 + (7 - s.StartBit%8)
+    return msb, msb + s.Length - 1
+}
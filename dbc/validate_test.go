@@ -0,0 +1,93 @@
+package dbc
+
+import (
+    "errors"
+    "strings"
+    "testing"
+)
+
+func TestSignalBitSpan(t *testing.T) {
+    tests := []struct {
+        what   string
+        sig    Signal
+        lo, hi int
+    }{
+        {"intel first bit", Signal{StartBit: 0, Length: 1}, 0, 0},
+        {"intel first byte", Signal{StartBit: 0, Length: 8}, 0, 7},
+        {"intel last byte", Signal{StartBit: 56, Length: 8}, 56, 63},
+        {"intel last bit", Signal{StartBit: 63, Length: 1}, 63, 63},
+        {"intel whole frame", Signal{StartBit: 0, Length: 64}, 0, 63},
+        {"intel FD last byte", Signal{StartBit: 504, Length: 8}, 504, 511},
+        {"motorola first byte", Signal{StartBit: 7, Length: 8, Endianness: BigEndian}, 0, 7},
+        {"motorola first bit", Signal{StartBit: 7, Length: 1, Endianness: BigEndian}, 0, 0},
+        {"motorola two bytes", Signal{StartBit: 7, Length: 16, Endianness: BigEndian}, 0, 15},
+        {"motorola last byte", Signal{StartBit: 63, Length: 8, Endianness: BigEndian}, 56, 63},
+        {"motorola last bit", Signal{StartBit: 56, Length: 1, Endianness: BigEndian}, 63, 63},
+        {"motorola whole frame", Signal{StartBit: 7, Length: 64, Endianness: BigEndian}, 0, 63},
+        {"motorola FD last byte", Signal{StartBit: 511, Length: 8, Endianness: BigEndian}, 504, 511},
+    }
+    for _, tt := range tests {
+        if lo, hi := tt.sig.bitSpan(); lo != tt.lo || hi != tt.hi {
+            t.Errorf("%s: got %d..%d, want %d..%d", tt.what, lo, hi, tt.lo, tt.hi)
+        }
+    }
+}
+
+func TestValidate(t *testing.T) {
+    tests := []struct {
+        what string
+        msg  Message
+        want string // substring of the error, "" for none
+    }{
+        {"fits", Message{DLC: 8, Signals: []Signal{
+            {Name: "I", StartBit: 56, Length: 8},
+            {Name: "M", StartBit: 7, Length: 8, Endianness: BigEndian},
+        }}, ""},
+        {"intel past the end", Message{DLC: 8, Signals: []Signal{{Name: "I", StartBit: 57, Length: 8}}}, "does not fit"},
+        {"motorola past the end", Message{DLC: 8, Signals: []Signal{{Name: "M", StartBit: 56, Length: 2, Endianness: BigEndian}}}, "does not fit"},
+        {"short frame", Message{DLC: 2, Signals: []Signal{{Name: "M", StartBit: 23, Length: 8, Endianness: BigEndian}}}, "does not fit"},
+        {"classic DLC 12", Message{DLC: 12}, "not a valid CAN payload"},
+        {"FD DLC 12", Message{DLC: 12, IsFD: true}, ""},
+        {"FD 12 bytes past the end", Message{DLC: 12, IsFD: true, Signals: []Signal{{Name: "I", StartBit: 100, Length: 8}}}, "does not fit"},
+        {"FD DLC 10", Message{DLC: 10, IsFD: true}, ""}, // DLC code for 16 bytes
+        {"FD 17 bytes", Message{DLC: 17, IsFD: true}, "not a valid CAN FD payload"},
+        {"FD last bit", Message{DLC: 64, IsFD: true, Signals: []Signal{{Name: "M", StartBit: 504, Length: 8}}}, ""},
+        {"float length", Message{DLC: 8, Signals: []Signal{{Name: "F", Length: 16, ValueType: ValueFloat}}}, "must be 32 bits"},
+        {"mux switch", Message{DLC: 8, Signals: []Signal{{Name: "S", Length: 8, MuxSwitchName: "X"}}}, "not a switch"},
+    }
+    for _, tt := range tests {
+        tt.msg.Name = "M"
+        f := &DBCFile{Messages: []Message{tt.msg}}
+        err := f.Validate()
+        switch {
+        case tt.want == "" && err != nil:
+            t.Errorf("%s: %v", tt.what, err)
+        case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+            t.Errorf("%s: got %v, want %q", tt.what, err, tt.want)
+        }
+    }
+}
+
+func TestValidationDiagnostics(t *testing.T) {
+    f := mustParse(t, "BU_: ECU1\n\nBO_ 100 M: 1 ECU1\n  SG_ S : 4|8@1+ (1,0) [0|255] \"\" ECU1\n")
+    diags := f.ValidationDiagnostics()
+    if len(diags) != 1 {
+        t.Fatalf("got %v, want one diagnostic", diags)
+    }
+    d := diags[0]
+    if d.Line != 4 || d.Column != 3 || d.Code != CodeInvalid || d.Severity != SeverityError || strings.HasPrefix(d.Message, "4:") {
+        t.Errorf("got %+v", d)
+    }
+    var se *SourceError
+    if !errors.As(f.Validate(), &se) || se.Source.Line != 4 {
+        t.Errorf("Validate: got %v, want a SourceError on line 4", f.Validate())
+    }
+}
+
+func TestValidationPointsAtValueType(t *testing.T) {
+    f := mustParse(t, "BO_ 100 M: 8 Vector__XXX\n  SG_ S : 0|16@1+ (1,0) [0|0] \"\" Vector__XXX\n\nSIG_VALTYPE_ 100 S : 1;\n")
+    var se *SourceError
+    if !errors.As(f.Validate(), &se) || se.Source.Line != 4 {
+        t.Errorf("got %v, want a SourceError on the SIG_VALTYPE_ line", f.Validate())
+    }
+}
@@ -1,6 +1,7 @@
 import { useState, useEffect, useMemo } from "react"
 import { Toolbar } from "./components/Toolbar"
 import { MessagesTable } from "./components/MessagesTable"
+import { DiagnosticsPanel } from "./components/DiagnosticsPanel"
 import { FontAwesomeIcon } from "@fortawesome/react-fontawesome"
 import { faX } from "@fortawesome/free-solid-svg-icons"
 import { Button } from "./components/ui/button"
@@ -72,8 +73,8 @@ export default function App() {
 
         {hasTabs ? (
           <div className="flex-1 overflow-auto">
-            {activeFile ? (
-              <MessagesTable messages={activeFile.messages} />
+            {activeFile && activeTab ? (
+              <MessagesTable fileIndex={activeTab.fileIndex} messages={activeFile.messages} />
             ) : (
               <div className="p-4 text-gray-400 italic">
                 No file loaded
@@ -85,6 +86,7 @@ export default function App() {
             No tab selected
           </div>
         )}
+        {activeFile && <DiagnosticsPanel diagnostics={activeFile.diagnostics} />}
       </div>
     </div>
   )
@@ -0,0 +1,34 @@
+import { dbc } from "../../wailsjs/go/models"
+
+interface DiagnosticsPanelProps {
+  diagnostics: dbc.Diagnostic[] | null
+}
+
+// severity values of dbc.Severity
+const SEVERITY_WARNING = 1
+
+// DiagnosticsPanel lists the statements a lenient parse had to skip and the
+// problems validation found in what was parsed
+export function DiagnosticsPanel({ diagnostics }: DiagnosticsPanelProps) {
+  if (!diagnostics || diagnostics.length === 0) return null
+
+  return (
+    <div className="max-h-40 overflow-auto border-t border-gray-100 text-xs font-mono">
+      <div className="px-2 py-1 bg-gray-50 text-gray-500">
+        {diagnostics.length} problem{diagnostics.length === 1 ? "" : "s"} in this file; statements with syntax errors were skipped
+      </div>
+      {diagnostics.map((d, i) => (
+        <div key={i} className="flex gap-2 px-2 py-0.5">
+          <span className={d.severity === SEVERITY_WARNING ? "text-amber-600" : "text-red-600"}>
+            {d.severity === SEVERITY_WARNING ? "warning" : "error"}
+          </span>
+          <span className="text-gray-400">
+            {d.line}:{d.column}
+          </span>
+          <span>{d.message}</span>
+          <span className="text-gray-400">[{d.code}]</span>
+        </div>
+      ))}
+    </div>
+  )
+}
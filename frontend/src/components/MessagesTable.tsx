@@ -4,12 +4,24 @@ import { useEffect, useState } from "react"
 import { Button } from "./ui/button"
 import { FontAwesomeIcon } from "@fortawesome/react-fontawesome"
 import { faAngleLeft } from "@fortawesome/free-solid-svg-icons"
+import { ValueDescriptionsCell } from "./ValueDescriptionsCell"
 
 interface MessagesTableProps {
+  fileIndex: number
   messages: dbc.Message[] 
 }
 
-export function MessagesTable({ messages }: MessagesTableProps) {
+// rawMessageID returns the BO_ ID as written in the file (bit 31 set for extended frames)
+function rawMessageID(msg: dbc.Message): number {
+  return msg.is_extended ? (msg.id | 0x80000000) >>> 0 : msg.id
+}
+
+// sourceLocation returns "line 12" for objects parsed from a file, for tooltips
+function sourceLocation(source: dbc.SourceSpan | undefined): string | undefined {
+  return source && source.line > 0 ? `line ${source.line}` : undefined
+}
+
+export function MessagesTable({ fileIndex, messages }: MessagesTableProps) {
   const [isFocused, setIsFocused] = useState<boolean>(false)
   const [focusedMessage, setFocusedMessage] = useState<dbc.Message | null>(null)
 
@@ -29,7 +41,10 @@ export function MessagesTable({ messages }: MessagesTableProps) {
     }
   }, [])
 
-  if (isFocused) {
+  if (isFocused && focusedMessage) {
+    // look the message up again so edits made through the backend show up
+    const shownMessage = messages?.find((m) => rawMessageID(m) === rawMessageID(focusedMessage)) ?? focusedMessage
+
     return (
       <div className="p-4 overflow-auto h-full">
         <div className="flex items-center">
@@ -45,7 +60,7 @@ export function MessagesTable({ messages }: MessagesTableProps) {
           </Button>
           <div className="flex flex-col">
             <span className="py-0 my-0 text-gray-400 text-xs italic">Message</span>
-            <h2 className="py-0 my-0">{focusedMessage?.name}</h2>
+            <h2 className="py-0 my-0" title={sourceLocation(shownMessage.source)}>{shownMessage.name}</h2>
           </div>
         </div>
         <Table>
@@ -61,13 +76,14 @@ export function MessagesTable({ messages }: MessagesTableProps) {
               <TableHead className="w-24">Is Signed</TableHead>
               <TableHead className="w-24">Start Bit</TableHead>
               <TableHead>Endianness</TableHead>
+              <TableHead>Values</TableHead>
               <TableHead>Comment</TableHead>
             </TableRow>
           </TableHeader>
           <TableBody>
-            {focusedMessage?.signals.map((sig) => 
+            {shownMessage.signals?.map((sig) => 
               <TableRow key={sig.name}>
-                <TableCell>{sig.name}</TableCell>
+                <TableCell title={sourceLocation(sig.source)}>{sig.name}</TableCell>
                 <TableCell>{sig.max}</TableCell>
                 <TableCell>{sig.min}</TableCell>
                 <TableCell>{sig.length}</TableCell>
@@ -77,6 +93,14 @@ export function MessagesTable({ messages }: MessagesTableProps) {
                 <TableCell>{sig.is_signed}</TableCell>
                 <TableCell>{sig.start_bit}</TableCell>
                 <TableCell>{sig.endianness}</TableCell>
+                <TableCell title={sourceLocation(sig.value_descriptions_source)}>
+                  <ValueDescriptionsCell
+                    fileIndex={fileIndex}
+                    messageID={rawMessageID(shownMessage)}
+                    signalName={sig.name}
+                    values={sig.value_descriptions}
+                  />
+                </TableCell>
                 <TableCell>{sig.comment}</TableCell>
               </TableRow>
             )}
@@ -102,7 +126,7 @@ export function MessagesTable({ messages }: MessagesTableProps) {
         <TableBody>
           {messages?.map((msg) => 
             <TableRow 
-              key={msg.id} 
+              key={rawMessageID(msg)} 
               onClick={() => {
                 setFocusedMessage(msg)
               }}
@@ -111,9 +135,21 @@ export function MessagesTable({ messages }: MessagesTableProps) {
               }}
               className={`cursor-pointer ${focusedMessage === msg && "border-blue-300"}`}
             >
-              <TableCell>0x{msg.id.toString(16).toUpperCase()}</TableCell>
-              <TableCell>{msg.name}</TableCell>
-              <TableCell>{msg.dlc}</TableCell>
+              <TableCell>
+                0x{msg.id.toString(16).toUpperCase()}
+                {msg.is_extended && (
+                  <span className="ml-1 text-xs text-gray-400" title="Extended (29-bit) frame">X</span>
+                )}
+              </TableCell>
+              <TableCell title={sourceLocation(msg.source)}>{msg.name}</TableCell>
+              <TableCell>
+                {msg.dlc}
+                {msg.is_fd && (
+                  <span className="ml-1 text-xs text-gray-400" title={msg.brs ? "CAN FD with bit rate switch" : "CAN FD"}>
+                    FD{msg.brs && "+BRS"}
+                  </span>
+                )}
+              </TableCell>
               <TableCell>{msg.transmitters.join(", ")}</TableCell>
               <TableCell>{msg.signals?.length}</TableCell>
               <TableCell>{msg.comment}</TableCell>
@@ -1,19 +1,26 @@
 import { useDbcStore } from "@/store/useDbcStore"
-import { ParseDBC, SaveFile, SaveFileAs } from "../../wailsjs/go/main/App"
+import { GetEncodings, ParseDBC, SaveFile, SaveFileAs } from "../../wailsjs/go/main/App"
 import { Button } from "./ui/button"
-import { useCallback } from "react"
+import { useCallback, useEffect, useState } from "react"
 
 export function Toolbar() {
   const tabs = useDbcStore(s => s.tabs)
   const activeTabID = useDbcStore(s => s.activeTabID)
+  // encoding to open files with; "" detects it
+  const [encoding, setEncoding] = useState("")
+  const [encodings, setEncodings] = useState<string[]>([])
+
+  useEffect(() => {
+    GetEncodings().then(setEncodings).catch(err => console.error("GetEncodings failed:", err))
+  }, [])
 
   const onOpenClick = useCallback(async () => {
     try {
-      await ParseDBC()
+      await ParseDBC(encoding)
     } catch (err) {
       console.error("Open DBC failed:", err)
     }
-  }, [])
+  }, [encoding])
 
   const onSaveClick = useCallback(async () => {
     try {
@@ -46,6 +53,15 @@ export function Toolbar() {
       <Button variant="ghost" className="no-drag" onClick={onOpenClick}>
         Open
       </Button>
+      <select
+        className="no-drag h-9 rounded-md border bg-transparent px-2 text-sm"
+        title="Encoding to open files with"
+        value={encoding}
+        onChange={e => setEncoding(e.target.value)}
+      >
+        <option value="">Auto-detect</option>
+        {encodings.map(enc => <option key={enc} value={enc}>{enc}</option>)}
+      </select>
       <Button 
         variant="ghost" 
         className="no-drag" 
@@ -0,0 +1,120 @@
+import { useEffect, useState, type KeyboardEvent } from "react"
+import { Input } from "./ui/input"
+import { Button } from "./ui/button"
+import { FontAwesomeIcon } from "@fortawesome/react-fontawesome"
+import { faPlus, faXmark } from "@fortawesome/free-solid-svg-icons"
+import { SetSignalValueDescriptions } from "../../wailsjs/go/main/App"
+import { useDbcStore } from "@/store/useDbcStore"
+
+interface ValueDescriptionsCellProps {
+  fileIndex: number
+  messageID: number
+  signalName: string
+  values: Record<number, string> | null
+}
+
+// ValueRow is one VAL_ entry being edited; value stays a string until committed
+interface ValueRow {
+  value: string
+  label: string
+}
+
+// toRows lists VAL_ entries in ascending value order
+function toRows(values: Record<number, string> | null): ValueRow[] {
+  if (!values) return []
+  return Object.keys(values)
+    .map(Number)
+    .sort((a, b) => a - b)
+    .map((k) => ({ value: String(k), label: values[k] }))
+}
+
+// fromRows is the inverse of toRows; rows without an integer value are dropped
+function fromRows(rows: ValueRow[]): Record<number, string> {
+  const values: Record<number, string> = {}
+  for (const row of rows) {
+    const text = row.value.trim()
+    if (!/^-?\d+$/.test(text)) continue
+    values[Number(text)] = row.label
+  }
+  return values
+}
+
+// sameValues compares two VAL_ tables entry by entry
+function sameValues(a: Record<number, string>, b: Record<number, string> | null): boolean {
+  const bb = b ?? {}
+  const keys = Object.keys(a)
+  return keys.length === Object.keys(bb).length && keys.every((k) => bb[Number(k)] === a[Number(k)])
+}
+
+export function ValueDescriptionsCell({ fileIndex, messageID, signalName, values }: ValueDescriptionsCellProps) {
+  const fetchFiles = useDbcStore((s) => s.fetchFiles)
+  const [rows, setRows] = useState<ValueRow[]>(toRows(values))
+
+  useEffect(() => {
+    setRows(toRows(values))
+  }, [values])
+
+  const commit = async (next: ValueRow[]) => {
+    const parsed = fromRows(next)
+    if (sameValues(parsed, values)) return
+    try {
+      await SetSignalValueDescriptions(fileIndex, messageID, signalName, parsed)
+      await fetchFiles()
+    } catch (err) {
+      console.error("Update value descriptions failed:", err)
+    }
+  }
+
+  const update = (i: number, change: Partial<ValueRow>) => {
+    setRows(rows.map((row, j) => (j === i ? { ...row, ...change } : row)))
+  }
+
+  const remove = (i: number) => {
+    const next = rows.filter((_, j) => j !== i)
+    setRows(next)
+    commit(next)
+  }
+
+  const onKeyDown = (e: KeyboardEvent<HTMLInputElement>) => {
+    if (e.key === "Enter") e.currentTarget.blur()
+  }
+
+  return (
+    <div className="flex flex-col gap-1 min-w-64">
+      {rows.map((row, i) => (
+        <div key={i} className="flex items-center gap-1">
+          <Input
+            className="h-8 w-20"
+            type="number"
+            step={1}
+            value={row.value}
+            placeholder="0"
+            onChange={(e) => update(i, { value: e.target.value })}
+            onBlur={() => commit(rows)}
+            onKeyDown={onKeyDown}
+          />
+          <Input
+            className="h-8 flex-1"
+            value={row.label}
+            placeholder="Description"
+            onChange={(e) => update(i, { label: e.target.value })}
+            onBlur={() => commit(rows)}
+            onKeyDown={onKeyDown}
+          />
+          <Button variant="ghost" size="icon" className="h-8 w-8" title="Remove value" onClick={() => remove(i)}>
+            <FontAwesomeIcon icon={faXmark} />
+          </Button>
+        </div>
+      ))}
+      <Button
+        variant="ghost"
+        size="sm"
+        className="h-8 self-start"
+        title="Add value"
+        onClick={() => setRows([...rows, { value: "", label: "" }])}
+      >
+        <FontAwesomeIcon icon={faPlus} />
+      </Button>
+    </div>
+  )
+}
@@ -4,10 +4,16 @@ import {dbc} from '../models';
 
 export function GetDBCFiles():Promise<Array<dbc.DBCFile>>;
 
+export function GetEffectiveAttribute(arg1:number,arg2:string,arg3:string,arg4:string):Promise<string>;
+
+export function GetEncodings():Promise<Array<string>>;
+
 export function Greet(arg1:string):Promise<string>;
 
-export function ParseDBC():Promise<void>;
+export function ParseDBC(arg1:string):Promise<void>;
 
 export function SaveFile(arg1:number):Promise<void>;
 
 export function SaveFileAs(arg1:number):Promise<void>;
+
+export function SetSignalValueDescriptions(arg1:number,arg2:number,arg3:string,arg4:Record<number, string>):Promise<void>;
@@ -6,12 +6,20 @@ export function GetDBCFiles() {
   return window['go']['main']['App']['GetDBCFiles']();
 }
 
+export function GetEffectiveAttribute(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['GetEffectiveAttribute'](arg1, arg2, arg3, arg4);
+}
+
+export function GetEncodings() {
+  return window['go']['main']['App']['GetEncodings']();
+}
+
 export function Greet(arg1) {
   return window['go']['main']['App']['Greet'](arg1);
 }
 
-export function ParseDBC() {
-  return window['go']['main']['App']['ParseDBC']();
+export function ParseDBC(arg1) {
+  return window['go']['main']['App']['ParseDBC'](arg1);
 }
 
 export function SaveFile(arg1) {
@@ -21,3 +29,7 @@ export function SaveFile(arg1) {
 export function SaveFileAs(arg1) {
   return window['go']['main']['App']['SaveFileAs'](arg1);
 }
+
+export function SetSignalValueDescriptions(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['SetSignalValueDescriptions'](arg1, arg2, arg3, arg4);
+}
@@ -1,11 +1,35 @@
 export namespace dbc {
 	
+	export class SourceSpan {
+	    file: string;
+	    line: number;
+	    column: number;
+	    end_line: number;
+	    end_column: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new SourceSpan(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.file = source["file"];
+	        this.line = source["line"];
+	        this.column = source["column"];
+	        this.end_line = source["end_line"];
+	        this.end_column = source["end_column"];
+	    }
+	}
 	export class AttributeDefinition {
 	    name: string;
 	    data_type: number;
 	    applies_to: string[];
+	    min: number;
+	    max: number;
 	    default_value: string;
 	    enum_values: string[];
+	    source: SourceSpan;
+	    default_source: SourceSpan;
 	
 	    static createFrom(source: any = {}) {
 	        return new AttributeDefinition(source);
@@ -16,15 +40,39 @@ export namespace dbc {
 	        this.name = source["name"];
 	        this.data_type = source["data_type"];
 	        this.applies_to = source["applies_to"];
+	        this.min = source["min"];
+	        this.max = source["max"];
 	        this.default_value = source["default_value"];
 	        this.enum_values = source["enum_values"];
+	        this.source = this.convertValues(source["source"], SourceSpan);
+	        this.default_source = this.convertValues(source["default_source"], SourceSpan);
 	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
 	}
+
 	export class AttributeValue {
 	    object_type: string;
 	    object_name: string;
 	    attr_name: string;
 	    value: string;
+	    source: SourceSpan;
 	
 	    static createFrom(source: any = {}) {
 	        return new AttributeValue(source);
@@ -36,8 +84,28 @@ export namespace dbc {
 	        this.object_name = source["object_name"];
 	        this.attr_name = source["attr_name"];
 	        this.value = source["value"];
+	        this.source = this.convertValues(source["source"], SourceSpan);
 	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
 	}
+
 	export class BaudRate {
 	    rate: number;
 	
@@ -54,6 +122,7 @@ export namespace dbc {
 	    object_type: string;
 	    object_name: string;
 	    text: string;
+	    source: SourceSpan;
 	
 	    static createFrom(source: any = {}) {
 	        return new Comment(source);
@@ -64,11 +133,123 @@ export namespace dbc {
 	        this.object_type = source["object_type"];
 	        this.object_name = source["object_name"];
 	        this.text = source["text"];
+	        this.source = this.convertValues(source["source"], SourceSpan);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+	export class Diagnostic {
+	    line: number;
+	    column: number;
+	    severity: number;
+	    code: string;
+	    message: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new Diagnostic(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.line = source["line"];
+	        this.column = source["column"];
+	        this.severity = source["severity"];
+	        this.code = source["code"];
+	        this.message = source["message"];
+	    }
+	}
+	export class EnvironmentVariable {
+	    name: string;
+	    type: number;
+	    min: number;
+	    max: number;
+	    unit: string;
+	    initial_value: number;
+	    id: number;
+	    access_type: number;
+	    access_nodes: string[];
+	    data_size: number;
+	    value_descriptions: Record<number, string>;
+	    source: SourceSpan;
+	    data_size_source: SourceSpan;
+	    value_descriptions_source: SourceSpan;
+	
+	    static createFrom(source: any = {}) {
+	        return new EnvironmentVariable(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.type = source["type"];
+	        this.min = source["min"];
+	        this.max = source["max"];
+	        this.unit = source["unit"];
+	        this.initial_value = source["initial_value"];
+	        this.id = source["id"];
+	        this.access_type = source["access_type"];
+	        this.access_nodes = source["access_nodes"];
+	        this.data_size = source["data_size"];
+	        this.value_descriptions = source["value_descriptions"];
+	        this.source = this.convertValues(source["source"], SourceSpan);
+	        this.data_size_source = this.convertValues(source["data_size_source"], SourceSpan);
+	        this.value_descriptions_source = this.convertValues(source["value_descriptions_source"], SourceSpan);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+	export class MuxValueRange {
+	    min: number;
+	    max: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new MuxValueRange(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.min = source["min"];
+	        this.max = source["max"];
 	    }
 	}
 	export class RawSection {
 	    keyword: string;
 	    lines: string[];
+	    source: SourceSpan;
 	
 	    static createFrom(source: any = {}) {
 	        return new RawSection(source);
@@ -78,14 +259,35 @@ export namespace dbc {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.keyword = source["keyword"];
 	        this.lines = source["lines"];
+	        this.source = this.convertValues(source["source"], SourceSpan);
 	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
 	}
+
 	export class Signal {
 	    name: string;
 	    start_bit: number;
 	    length: number;
 	    endianness: number;
 	    is_signed: boolean;
+	    value_type: number;
 	    factor: number;
 	    offset: number;
 	    min: number;
@@ -94,7 +296,14 @@ export namespace dbc {
 	    receivers: string[];
 	    mux_type: number;
 	    mux_value: number;
+	    mux_switch: string;
+	    mux_ranges: MuxValueRange[];
 	    comment: string;
+	    value_descriptions: Record<number, string>;
+	    source: SourceSpan;
+	    value_descriptions_source: SourceSpan;
+	    value_type_source: SourceSpan;
+	    mux_source: SourceSpan;
 	
 	    static createFrom(source: any = {}) {
 	        return new Signal(source);
@@ -107,6 +316,7 @@ export namespace dbc {
 	        this.length = source["length"];
 	        this.endianness = source["endianness"];
 	        this.is_signed = source["is_signed"];
+	        this.value_type = source["value_type"];
 	        this.factor = source["factor"];
 	        this.offset = source["offset"];
 	        this.min = source["min"];
@@ -115,16 +325,84 @@ export namespace dbc {
 	        this.receivers = source["receivers"];
 	        this.mux_type = source["mux_type"];
 	        this.mux_value = source["mux_value"];
+	        this.mux_switch = source["mux_switch"];
+	        this.mux_ranges = this.convertValues(source["mux_ranges"], MuxValueRange);
 	        this.comment = source["comment"];
+	        this.value_descriptions = source["value_descriptions"];
+	        this.source = this.convertValues(source["source"], SourceSpan);
+	        this.value_descriptions_source = this.convertValues(source["value_descriptions_source"], SourceSpan);
+	        this.value_type_source = this.convertValues(source["value_type_source"], SourceSpan);
+	        this.mux_source = this.convertValues(source["mux_source"], SourceSpan);
 	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
 	}
+	export class SignalGroup {
+	    name: string;
+	    repetitions: number;
+	    signals: string[];
+	    source: SourceSpan;
+	
+	    static createFrom(source: any = {}) {
+	        return new SignalGroup(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.repetitions = source["repetitions"];
+	        this.signals = source["signals"];
+	        this.source = this.convertValues(source["source"], SourceSpan);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
 	export class Message {
 	    id: number;
+	    is_extended: boolean;
 	    name: string;
 	    dlc: number;
+	    is_fd: boolean;
+	    brs: boolean;
 	    transmitters: string[];
 	    signals: Signal[];
+	    signal_groups: SignalGroup[];
 	    comment: string;
+	    source: SourceSpan;
+	    transmitters_source: SourceSpan;
 	
 	    static createFrom(source: any = {}) {
 	        return new Message(source);
@@ -133,11 +411,17 @@ export namespace dbc {
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.id = source["id"];
+	        this.is_extended = source["is_extended"];
 	        this.name = source["name"];
 	        this.dlc = source["dlc"];
+	        this.is_fd = source["is_fd"];
+	        this.brs = source["brs"];
 	        this.transmitters = source["transmitters"];
 	        this.signals = this.convertValues(source["signals"], Signal);
+	        this.signal_groups = this.convertValues(source["signal_groups"], SignalGroup);
 	        this.comment = source["comment"];
+	        this.source = this.convertValues(source["source"], SourceSpan);
+	        this.transmitters_source = this.convertValues(source["transmitters_source"], SourceSpan);
 	    }
 	
 		convertValues(a: any, classs: any, asMap: boolean = false): any {
@@ -161,6 +445,7 @@ export namespace dbc {
 	export class ValueTable {
 	    name: string;
 	    values: Record<number, string>;
+	    source: SourceSpan;
 	
 	    static createFrom(source: any = {}) {
 	        return new ValueTable(source);
@@ -170,10 +455,31 @@ export namespace dbc {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.name = source["name"];
 	        this.values = source["values"];
+	        this.source = this.convertValues(source["source"], SourceSpan);
 	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
 	}
+
 	export class Node {
 	    name: string;
+	    source: SourceSpan;
 	
 	    static createFrom(source: any = {}) {
 	        return new Node(source);
@@ -182,8 +488,28 @@ export namespace dbc {
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.name = source["name"];
+	        this.source = this.convertValues(source["source"], SourceSpan);
 	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
 	}
+
 	export class DBCFile {
 	    version: string;
 	    // Go type: time
@@ -193,12 +519,16 @@ export namespace dbc {
 	    filename: string;
 	    nodes: Node[];
 	    baud_rates: BaudRate[];
+	    bit_timing_source: SourceSpan;
 	    value_tables: ValueTable[];
 	    messages: Message[];
+	    env_vars: EnvironmentVariable[];
 	    attributes: AttributeDefinition[];
 	    attr_values: AttributeValue[];
 	    comments: Comment[];
 	    raw_sections: RawSection[];
+	    encoding: string;
+	    diagnostics: Diagnostic[];
 	
 	    static createFrom(source: any = {}) {
 	        return new DBCFile(source);
@@ -213,12 +543,16 @@ export namespace dbc {
 	        this.filename = source["filename"];
 	        this.nodes = this.convertValues(source["nodes"], Node);
 	        this.baud_rates = this.convertValues(source["baud_rates"], BaudRate);
+	        this.bit_timing_source = this.convertValues(source["bit_timing_source"], SourceSpan);
 	        this.value_tables = this.convertValues(source["value_tables"], ValueTable);
 	        this.messages = this.convertValues(source["messages"], Message);
+	        this.env_vars = this.convertValues(source["env_vars"], EnvironmentVariable);
 	        this.attributes = this.convertValues(source["attributes"], AttributeDefinition);
 	        this.attr_values = this.convertValues(source["attr_values"], AttributeValue);
 	        this.comments = this.convertValues(source["comments"], Comment);
 	        this.raw_sections = this.convertValues(source["raw_sections"], RawSection);
+	        this.encoding = source["encoding"];
+	        this.diagnostics = this.convertValues(source["diagnostics"], Diagnostic);
 	    }
 	
 		convertValues(a: any, classs: any, asMap: boolean = false): any {
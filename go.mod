@@ -4,7 +4,10 @@ go 1.22.0
 
 toolchain go1.24.2
 
-require github.com/wailsapp/wails/v2 v2.10.1
+require (
+	github.com/wailsapp/wails/v2 v2.10.1
+	golang.org/x/text v0.22.0
+)
 
 require (
 	github.com/bep/debounce v1.2.1 // indirect
@@ -32,7 +35,6 @@ require (
 	golang.org/x/crypto v0.33.0 // indirect
 	golang.org/x/net v0.35.0 // indirect
 	golang.org/x/sys v0.30.0 // indirect
-	golang.org/x/text v0.22.0 // indirect
 )
 
 // replace github.com/wailsapp/wails/v2 v2.10.1 => /Users/kadeangell/go/pkg/mod